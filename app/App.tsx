@@ -1,4 +1,4 @@
-import React from "react";
+import React, { useEffect } from "react";
 import { NavigationContainer } from "@react-navigation/native";
 import { createNativeStackNavigator } from "@react-navigation/native-stack";
 import "react-native-gesture-handler";
@@ -14,6 +14,7 @@ import IntroScreen from "./src/screens/IntroScreen";
 
 import "./global.css";
 import { RefreshProvider } from "./src/RefreshContext";
+import { startPartnerPolling } from "./src/partnerNotifications";
 
 export type RootStackParamList = {
   Today: undefined;
@@ -28,6 +29,9 @@ export type RootStackParamList = {
 const Stack = createNativeStackNavigator<RootStackParamList>();
 
 export default function App() {
+  // Partner nudges, cheers and finished days arrive as local notifications.
+  useEffect(() => startPartnerPolling(), []);
+
   return (
     <GestureHandlerRootView style={{ flex: 1 }}>
       <SafeAreaProvider>
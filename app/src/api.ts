@@ -1,6 +1,12 @@
 // app/src/api.ts
 import { API_BASE } from "./config";
-import type { PlanDetail, PlanListItem, CreatePlanResponse } from "./types";
+import type {
+  PlanDetail,
+  PlanListItem,
+  CreatePlanResponse,
+  DayStatus,
+  PartnerEvent,
+} from "./types";
 import { getOrCreateUserId } from "./storage/userId"; 
 
 
@@ -36,7 +42,17 @@ async function fetchJSON<T>(
     if (!res.ok) {
       let body = "";
       try {
-        body = isJSON ? JSON.stringify(await res.json()) : await res.text();
+        if (isJSON) {
+          // Errors come as {"error": {code, message, request_id, details?}}
+          const data = await res.json();
+          const e = data?.error;
+          body =
+            e && typeof e === "object"
+              ? `${e.message ?? e.code}${e.request_id ? ` (request ${e.request_id})` : ""}`
+              : JSON.stringify(data);
+        } else {
+          body = await res.text();
+        }
       } catch {
         body = "";
       }
@@ -90,11 +106,24 @@ export async function patchDayDone(
 ) {
   return await fetchJSON(`${API_BASE}/plans/${planId}/days/${dayNumber}`, {
     method: "PATCH",
-    headers: { "Content-Type": "application/json" },
+    headers: { "Content-Type": "application/merge-patch+json" },
     body: JSON.stringify({ is_done: isDone }),
   });
 }
 
+// "bad_day" counts as done; "skipped" pushes the day (and the rest) to tomorrow.
+export async function patchDayStatus(
+  planId: string,
+  dayNumber: number,
+  status: DayStatus,
+) {
+  return await fetchJSON(`${API_BASE}/plans/${planId}/days/${dayNumber}`, {
+    method: "PATCH",
+    headers: { "Content-Type": "application/merge-patch+json" },
+    body: JSON.stringify({ status }),
+  });
+}
+
 export async function patchDayContent(
   planId: string,
   dayNumber: number,
@@ -102,7 +131,7 @@ export async function patchDayContent(
 ) {
   return await fetchJSON(`${API_BASE}/plans/${planId}/days/${dayNumber}`, {
     method: "PATCH",
-    headers: { "Content-Type": "application/json" },
+    headers: { "Content-Type": "application/merge-patch+json" },
     body: JSON.stringify(payload),
   });
 }
@@ -111,3 +140,19 @@ export async function deletePlan(planId: string) {
   await fetchJSON(`${API_BASE}/plans/${planId}`, { method: "DELETE" });
   return true;
 }
+
+// Newest first; events addressed to the current user.
+export async function getPartnerFeed(limit = 50): Promise<PartnerEvent[]> {
+  const data = await fetchJSON<{ events?: PartnerEvent[] }>(
+    `${API_BASE}/partners/feed?limit=${limit}`,
+  );
+  return data.events ?? [];
+}
+
+export async function markPartnerFeedSeen(upToId: number) {
+  return await fetchJSON(`${API_BASE}/partners/feed/seen`, {
+    method: "POST",
+    headers: { "Content-Type": "application/json" },
+    body: JSON.stringify({ up_to_id: upToId }),
+  });
+}
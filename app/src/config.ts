@@ -1 +1 @@
-export const API_BASE = "https://sliceapp.onrender.com";
\ No newline at end of file
+export const API_BASE = "https://sliceapp.onrender.com/v1";
\ No newline at end of file
@@ -89,6 +89,14 @@ export async function scheduleDailyBless(params: {
   return id;
 }
 
+// Shows a notification right away (trigger null), e.g. a partner's nudge.
+export async function presentNow(params: { title: string; body: string }) {
+  return await Notifications.scheduleNotificationAsync({
+    content: { title: params.title, body: params.body, sound: true },
+    trigger: null,
+  });
+}
+
 export async function cancelNotifIds(ids: string[]) {
   await Promise.all(
     ids.filter(Boolean).map((id) => Notifications.cancelScheduledNotificationAsync(id))
@@ -0,0 +1,72 @@
+import { AppState, type AppStateStatus } from "react-native";
+import { getPartnerFeed, markPartnerFeedSeen } from "./api";
+import { ensureNotifPermission, presentNow } from "./notifications";
+import type { PartnerEvent } from "./types";
+
+// How often the feed is checked while the app is in the foreground.
+const POLL_MS = 60_000;
+
+function partnerNotifContent(ev: PartnerEvent) {
+  switch (ev.kind) {
+    case "cheer":
+      return { title: "Your partner cheered you on", body: ev.message || "Keep slicing!" };
+    case "day_done":
+      return {
+        title: "Your partner finished a day",
+        body: ev.day_number ? `Day ${ev.day_number} is done. Your turn.` : "Your turn.",
+      };
+    default:
+      return { title: "Your partner nudged you", body: ev.message || "Time to slice." };
+  }
+}
+
+let polling = false;
+
+// Turns unseen partner events into local notifications, then marks them
+// seen on the server so they aren't shown twice (here or on another device).
+export async function notifyPartnerEvents() {
+  if (polling) return;
+  polling = true;
+  try {
+    const events = await getPartnerFeed();
+    const unseen = events.filter((ev) => !ev.seen).reverse(); // oldest first
+    if (unseen.length === 0) return;
+
+    if (await ensureNotifPermission()) {
+      for (const ev of unseen) {
+        await presentNow(partnerNotifContent(ev));
+      }
+    }
+    await markPartnerFeedSeen(unseen[unseen.length - 1].id);
+  } catch (e) {
+    console.log("partner feed poll failed", e);
+  } finally {
+    polling = false;
+  }
+}
+
+// Polls on start, whenever the app comes back to the foreground and every
+// POLL_MS while it stays there. Returns a function that stops polling.
+export function startPartnerPolling() {
+  let timer: ReturnType<typeof setInterval> | null = null;
+
+  const start = () => {
+    void notifyPartnerEvents();
+    if (!timer) timer = setInterval(() => void notifyPartnerEvents(), POLL_MS);
+  };
+  const stop = () => {
+    if (timer) clearInterval(timer);
+    timer = null;
+  };
+
+  const sub = AppState.addEventListener("change", (state: AppStateStatus) => {
+    if (state === "active") start();
+    else stop();
+  });
+  if (AppState.currentState === "active") start();
+
+  return () => {
+    stop();
+    sub.remove();
+  };
+}
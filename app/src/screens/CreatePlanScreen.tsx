@@ -10,7 +10,7 @@ import {
 } from "react-native";
 import type { NativeStackScreenProps } from "@react-navigation/native-stack";
 import { createPlan } from "../api";
-import type { SplitterMeta, PlanDetail } from "../types";
+import type { SplitterMeta, CreatedPlan } from "../types";
 import type { RootStackParamList } from "../../App";
 import { Screen } from "../ui/Screen";
 import { CollageCard } from "../ui/CollageCard";
@@ -38,7 +38,7 @@ export default function CreatePlanScreen({ navigation }: Props) {
   useSliceHeader(navigation, { left: "none", right: "plans" });
 
   const [meta, setMeta] = useState<SplitterMeta | null>(null);
-  const [createdPlan, setCreatedPlan] = useState<PlanDetail | null>(null);
+  const [createdPlan, setCreatedPlan] = useState<CreatedPlan | null>(null);
   const [show, setShow] = useState(false);
   const { bump } = useRefresh();
 
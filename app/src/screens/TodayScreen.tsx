@@ -13,7 +13,7 @@ import {
   clearSelectedPlanId,
 } from "../storage/selectedPlan";
 import type { RootStackParamList } from "../../App";
-import { getPlan, listPlans, patchDayDone } from "../api";
+import { getPlan, listPlans, patchDayStatus } from "../api";
 import type { PlanDay, PlanDetail, PlanListItem } from "../types";
 import { useSliceHeader } from "../ui/useSliceHeader";
 import { Screen } from "../ui/Screen";
@@ -171,7 +171,8 @@ export default function TodayScreen({ navigation }: Props) {
     setOpenDoneIdx(null);
   }, [todayDay?.day_number]);
 
-  const markDoneToday = async () => {
+  // "bad_day" = only the BAD DAY step got done; it still counts.
+  const markDoneToday = async (status: "done" | "bad_day" = "done") => {
     if (!plan || !todayDay) return;
 
     try {
@@ -181,7 +182,7 @@ export default function TodayScreen({ navigation }: Props) {
       const willComplete = doneDaysNow + 1 >= plan.days;
       const remainingBefore = Math.max(plan.days - doneDaysNow, 0);
 
-      await patchDayDone(plan.id, todayDay.day_number, true);
+      await patchDayStatus(plan.id, todayDay.day_number, status);
 
       bump();
 
@@ -206,6 +207,17 @@ export default function TodayScreen({ navigation }: Props) {
     }
   };
 
+  const skipToday = async () => {
+    if (!plan || !todayDay) return;
+    try {
+      setErr("");
+      await patchDayStatus(plan.id, todayDay.day_number, "skipped");
+      bump();
+    } catch (e: any) {
+      setErr(e?.message ?? "skip failed");
+    }
+  };
+
   const saveToday = async () => {
     if (!plan || !todayDay) return;
 
@@ -501,10 +513,33 @@ export default function TodayScreen({ navigation }: Props) {
               <BrutalButton
                 label="Mark today as done"
                 tone="mustard"
-                onPress={markDoneToday}
+                onPress={() => markDoneToday("done")}
               />
             </View>
 
+            <View className="mt-3 flex-row gap-3">
+              <View className="flex-1">
+                <BrutalButton
+                  label="Bad day (BAD DAY step only)"
+                  tone="charcoal"
+                  onPress={() => markDoneToday("bad_day")}
+                />
+              </View>
+              <View className="flex-1">
+                <BrutalButton
+                  label="Skip today"
+                  tone="charcoal"
+                  onPress={skipToday}
+                />
+              </View>
+            </View>
+
+            {todayDay.status === "skipped" ? (
+              <Text className="mt-2 text-charcoal opacity-60 text-[12px] tracking-[1px]">
+                Skipped — this slice moved to tomorrow and the rest shifted a day.
+              </Text>
+            ) : null}
+
             <View className="mt-3">
               <BrutalButton
                 label="Open week"
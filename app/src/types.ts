@@ -1,15 +1,29 @@
+// Mirrors the schemas in backend/internal/httpapi/openapi.yaml
+// (served at GET /openapi.json); keep the two in sync.
+
 export type PlanDayStep = {
   title: string;
   minutes: number;
-  deliverable?: string;
+  deliverable: string;
   done_definition: string;
 };
 
+export type DayStatus = "pending" | "done" | "bad_day" | "skipped";
+
 export type PlanDay = {
   day_number: number;
   focus: string;
   steps: PlanDayStep[];
   is_done: boolean;
+  status?: DayStatus;
+};
+
+export type PlanStatus = "active" | "paused" | "archived" | "completed";
+
+export type TagRef = {
+  id: string;
+  name: string;
+  color: string;
 };
 
 export type PlanListItem = {
@@ -17,7 +31,13 @@ export type PlanListItem = {
   title: string;
   days: number;
   daily_minutes: number;
+  goal_type?: string;
+  status: PlanStatus;
   created_at: string;
+  role: string;
+  days_done: number;
+  days_total: number;
+  tags: TagRef[];
 };
 
 export type PlanDetail = {
@@ -25,10 +45,22 @@ export type PlanDetail = {
   title: string;
   days: number;
   daily_minutes: number;
+  goal_type?: string;
+  status?: PlanStatus;
+  source_plan_id?: string;
   created_at: string;
+  role?: string;
+  version?: number;
   items: PlanDay[];
 };
 
+export type APIError = {
+  code: string;
+  message: string;
+  request_id?: string;
+  details?: { step?: number; field: string; message: string }[];
+};
+
 export type SplitterMeta = {
   splitter_quote: string;
   mode: "normal" | "de_scope";
@@ -40,11 +72,35 @@ export type SplitterMeta = {
   success_rule: string;
   assumptions: string[];
   risk_notes: string[];
+  // true when the server reused an earlier answer for the same request
+  cached: boolean;
+};
+
+export type CreatedPlan = {
+  id: string;
+  title: string;
+  days: number;
+  daily_minutes: number;
+  created_at?: string;
+  items: PlanDay[];
 };
 
 export type CreatePlanResponse = {
   meta: SplitterMeta;
-  plan: PlanDetail;
+  plan: CreatedPlan;
 };
 
 
+
+export type PartnerEventKind = "nudge" | "cheer" | "day_done";
+
+export type PartnerEvent = {
+  id: number;
+  actor_id: string;
+  kind: PartnerEventKind;
+  message: string;
+  plan_id: string | null;
+  day_number: number | null;
+  created_at: string;
+  seen: boolean;
+};
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"log"
 	"net/http"
 	"time"
@@ -10,6 +11,9 @@ import (
 	"sliceapp-backend/internal/config"
 	"sliceapp-backend/internal/db"
 	"sliceapp-backend/internal/httpapi"
+	"sliceapp-backend/internal/ratelimit"
+	"sliceapp-backend/internal/realtime"
+	"sliceapp-backend/internal/splitcache"
 )
 
 func main() {
@@ -23,7 +27,21 @@ func main() {
 	}
 	defer pool.Close()
 
-	r := httpapi.NewRouter(pool, cfg)
+	hub := realtime.NewBroker()
+	if cfg.RealtimePGNotify {
+		go hub.ListenPostgres(context.Background(), pool, "slice_events")
+	}
+
+	retention := time.Duration(cfg.TrashRetentionDays) * 24 * time.Hour
+	go db.RunTrashPurge(context.Background(), pool, retention, time.Hour)
+	if cfg.RateLimitPG || cfg.AIDailyQuota > 0 {
+		go ratelimit.RunPurge(context.Background(), pool, time.Hour)
+	}
+	if cfg.SplitterCache && cfg.SplitterCachePG {
+		go splitcache.RunPurge(context.Background(), pool, time.Hour)
+	}
+
+	r := httpapi.NewRouter(pool, cfg, hub)
 
 	srv := &http.Server{
 		Addr:              ":" + cfg.Port,
@@ -0,0 +1,132 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// DayContext is what the model sees when it fills in one day of an
+// existing plan: the plan itself and the days around the new one.
+type DayContext struct {
+	PlanTitle    string
+	DailyMinutes int
+	DayNumber    int
+	Days         int
+	Prev         *PlanDay
+	Next         *PlanDay
+}
+
+// GenerateDay writes a single new day that fits between ctxDay.Prev and
+// ctxDay.Next, following the same 3-op and minutes rules as the splitter.
+func (c *Client) GenerateDay(ctx context.Context, ctxDay DayContext) (*PlanDay, error) {
+	if c.APIKey == "" {
+		return nil, errors.New("OPENAI_API_KEY is empty")
+	}
+	if c.Model == "" {
+		c.Model = "gpt-5.2"
+	}
+
+	reqBody := responsesReq{
+		Model:        c.Model,
+		Instructions: `Return ONLY valid JSON that matches the provided JSON Schema. No markdown. No extra text.`,
+		Input: []any{
+			map[string]any{
+				"role":    "user",
+				"content": buildDayPrompt(ctxDay),
+			},
+		},
+		Text: textConfig{
+			Format: jsonSchemaFormat{
+				Type:   "json_schema",
+				Name:   "slice_day",
+				Strict: true,
+				Schema: daySchema(),
+			},
+		},
+	}
+
+	jsonText, err := c.doResponses(ctx, reqBody)
+	if err != nil {
+		return nil, err
+	}
+
+	var day PlanDay
+	if err := json.Unmarshal([]byte(jsonText), &day); err != nil {
+		return nil, errors.New("ai returned invalid json: " + err.Error())
+	}
+	day.DayNumber = ctxDay.DayNumber
+
+	if len(day.Steps) != 3 {
+		return nil, errors.New("day must have exactly 3 steps")
+	}
+	sum := 0
+	for _, s := range day.Steps {
+		if s.Title == "" || s.Deliverable == "" || s.DoneDefinition == "" || s.Minutes <= 0 {
+			return nil, errors.New("step missing required fields")
+		}
+		sum += s.Minutes
+	}
+	if sum != ctxDay.DailyMinutes {
+		return nil, errors.New("ai returned wrong minutes total")
+	}
+
+	return &day, nil
+}
+
+func buildDayPrompt(d DayContext) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "You are “Slice Success Splitter”. The user has an existing plan titled %q ", d.PlanTitle)
+	fmt.Fprintf(&b, "and is inserting a new Day %d (the plan will have %d days).\n\n", d.DayNumber, d.Days)
+	b.WriteString("Write ONE day that fits naturally between its neighbours.\n\n")
+	b.WriteString("Rules (same as the rest of the plan):\n")
+	b.WriteString("- focus: one short line saying what this day moves forward.\n")
+	b.WriteString("- Exactly 3 steps, in order: [CORE], [MOMENTUM], [BAD DAY]; prefix each title with its tag.\n")
+	fmt.Fprintf(&b, "- Minutes must sum to exactly %d: BAD_DAY = clamp(round(D*0.15), 3, 10), ", d.DailyMinutes)
+	b.WriteString("MOMENTUM = clamp(round(D*0.25), 10, 25), CORE = the rest (reduce MOMENTUM if CORE < 10).\n")
+	b.WriteString("- Every step has title (verb-first, max 8 words), minutes, a concrete deliverable and a clear done_definition.\n")
+	b.WriteString("- Do not repeat a neighbouring day's work.\n\n")
+
+	writeDay := func(label string, p *PlanDay) {
+		if p == nil {
+			fmt.Fprintf(&b, "%s: (none)\n", label)
+			return
+		}
+		fmt.Fprintf(&b, "%s (Day %d): focus=%q\n", label, p.DayNumber, p.Focus)
+		for _, s := range p.Steps {
+			fmt.Fprintf(&b, "  - %s (%d min): %s\n", s.Title, s.Minutes, s.Deliverable)
+		}
+	}
+	writeDay("Previous day", d.Prev)
+	writeDay("Next day", d.Next)
+	return b.String()
+}
+
+func daySchema() map[string]any {
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"focus": map[string]any{"type": "string"},
+			"steps": map[string]any{
+				"type":     "array",
+				"minItems": 3,
+				"maxItems": 3,
+				"items": map[string]any{
+					"type": "object",
+					"properties": map[string]any{
+						"title":           map[string]any{"type": "string"},
+						"minutes":         map[string]any{"type": "integer"},
+						"deliverable":     map[string]any{"type": "string"},
+						"done_definition": map[string]any{"type": "string"},
+					},
+					"required":             []string{"title", "minutes", "deliverable", "done_definition"},
+					"additionalProperties": false,
+				},
+			},
+		},
+		"required":             []string{"focus", "steps"},
+		"additionalProperties": false,
+	}
+}
@@ -0,0 +1,119 @@
+package ai
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ShrinkDays rewrites the given days so their steps fit a new daily
+// budget. Day numbers are kept; the caller still sets the exact minutes.
+func (c *Client) ShrinkDays(ctx context.Context, planTitle string, dailyMinutes int, days []PlanDay) ([]PlanDay, error) {
+	if c.APIKey == "" {
+		return nil, errors.New("OPENAI_API_KEY is empty")
+	}
+	if c.Model == "" {
+		c.Model = "gpt-5.2"
+	}
+	if len(days) == 0 {
+		return nil, nil
+	}
+
+	reqBody := responsesReq{
+		Model:        c.Model,
+		Instructions: `Return ONLY valid JSON that matches the provided JSON Schema. No markdown. No extra text.`,
+		Input: []any{
+			map[string]any{
+				"role":    "user",
+				"content": buildShrinkPrompt(planTitle, dailyMinutes, days),
+			},
+		},
+		Text: textConfig{
+			Format: jsonSchemaFormat{
+				Type:   "json_schema",
+				Name:   "slice_shrink",
+				Strict: true,
+				Schema: shrinkSchema(len(days)),
+			},
+		},
+	}
+
+	jsonText, err := c.doResponses(ctx, reqBody)
+	if err != nil {
+		return nil, err
+	}
+
+	var parsed struct {
+		Items []PlanDay `json:"items"`
+	}
+	if err := json.Unmarshal([]byte(jsonText), &parsed); err != nil {
+		return nil, errors.New("ai returned invalid json: " + err.Error())
+	}
+
+	want := make(map[int]bool, len(days))
+	for _, d := range days {
+		want[d.DayNumber] = true
+	}
+	if len(parsed.Items) != len(days) {
+		return nil, errors.New("ai returned wrong number of days")
+	}
+	for _, d := range parsed.Items {
+		if !want[d.DayNumber] {
+			return nil, errors.New("ai returned an unexpected day_number")
+		}
+		delete(want, d.DayNumber)
+		if len(d.Steps) != 3 {
+			return nil, errors.New("each day must have exactly 3 steps")
+		}
+		for _, s := range d.Steps {
+			if s.Title == "" || s.Deliverable == "" || s.DoneDefinition == "" {
+				return nil, errors.New("step missing required fields")
+			}
+		}
+	}
+
+	return parsed.Items, nil
+}
+
+func buildShrinkPrompt(planTitle string, dailyMinutes int, days []PlanDay) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "You are “Slice Success Splitter”. The plan %q now only has %d minutes a day.\n", planTitle, dailyMinutes)
+	b.WriteString("Rewrite each day below so it still moves the goal forward but fits the smaller budget.\n\n")
+	b.WriteString("Rules:\n")
+	b.WriteString("- Keep every day_number and the same overall direction; cut scope, don't change topic.\n")
+	b.WriteString("- Exactly 3 steps per day, in order: [CORE], [MOMENTUM], [BAD DAY]; prefix each title with its tag.\n")
+	fmt.Fprintf(&b, "- Minutes per day must sum to %d: BAD_DAY = clamp(round(D*0.15), 3, 10), ", dailyMinutes)
+	b.WriteString("MOMENTUM = clamp(round(D*0.25), 10, 25), CORE = the rest (reduce MOMENTUM if CORE < 10).\n")
+	b.WriteString("- Deliverables and done_definitions must be achievable in the new minutes.\n\n")
+
+	for _, d := range days {
+		fmt.Fprintf(&b, "Day %d: focus=%q\n", d.DayNumber, d.Focus)
+		for _, s := range d.Steps {
+			fmt.Fprintf(&b, "  - %s (%d min): %s | done: %s\n", s.Title, s.Minutes, s.Deliverable, s.DoneDefinition)
+		}
+	}
+	return b.String()
+}
+
+func shrinkSchema(n int) map[string]any {
+	day := daySchema()
+	props := day["properties"].(map[string]any)
+	props["day_number"] = map[string]any{"type": "integer"}
+	day["required"] = []string{"day_number", "focus", "steps"}
+
+	return map[string]any{
+		"type": "object",
+		"properties": map[string]any{
+			"items": map[string]any{
+				"type":     "array",
+				"minItems": n,
+				"maxItems": n,
+				"items":    day,
+			},
+		},
+		"required":             []string{"items"},
+		"additionalProperties": false,
+	}
+}
@@ -15,6 +15,10 @@ type Client struct {
 	APIKey string
 	Model  string
 	HTTP   *http.Client
+
+	// Usage adds up the tokens of every call made with this client,
+	// including ones whose output was then rejected.
+	Usage Usage
 }
 
 func NewClient(apiKey, model string) *Client {
@@ -98,6 +102,13 @@ type responsesResp struct {
 			Text string `json:"text"`
 		} `json:"content"`
 	} `json:"output"`
+	Usage struct {
+		InputTokens        int `json:"input_tokens"`
+		InputTokensDetails struct {
+			CachedTokens int `json:"cached_tokens"`
+		} `json:"input_tokens_details"`
+		OutputTokens int `json:"output_tokens"`
+	} `json:"usage"`
 	Error any `json:"error"`
 }
 
@@ -128,6 +139,7 @@ func (c *Client) doResponses(ctx context.Context, reqBody responsesReq) (string,
 	if err := json.NewDecoder(resp.Body).Decode(&rr); err != nil {
 		return "", err
 	}
+	c.Usage.add(reqBody.Model, rr.Usage.InputTokens, rr.Usage.InputTokensDetails.CachedTokens, rr.Usage.OutputTokens)
 
 	// Extract first output_text
 	var jsonText string
@@ -5,6 +5,11 @@ import (
 	"strings"
 )
 
+// SplitterPromptVersion names the current BuildSplitterPrompt and
+// splitterSchema. Bump it with any change to either, so cached splitter
+// output from the old prompt stops being served.
+const SplitterPromptVersion = "1"
+
 func BuildSplitterPrompt(userGoal string, timeframeDays *int, dailyMinutes *int) string {
 	tf := "null"
 	if timeframeDays != nil {
@@ -0,0 +1,109 @@
+package ai
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Usage is the token count of one or more calls, as OpenAI reports it.
+// InputTokens includes CachedTokens.
+type Usage struct {
+	Model        string
+	InputTokens  int
+	CachedTokens int
+	OutputTokens int
+}
+
+func (u *Usage) add(model string, in, cached, out int) {
+	u.Model = model
+	u.InputTokens += in
+	u.CachedTokens += cached
+	u.OutputTokens += out
+}
+
+// Empty reports whether no call got as far as using tokens.
+func (u Usage) Empty() bool {
+	return u.InputTokens == 0 && u.OutputTokens == 0
+}
+
+// Price is USD per million tokens.
+type Price struct {
+	Input       float64
+	CachedInput float64
+	Output      float64
+}
+
+// Prices are list prices for the models we use. A dated snapshot
+// ("gpt-4o-mini-2024-07-18") is priced by its longest matching name.
+// Config can override or add entries (AI_PRICES).
+var Prices = map[string]Price{
+	"gpt-5.2":      {1.75, 0.175, 14},
+	"gpt-5":        {1.25, 0.125, 10},
+	"gpt-5-mini":   {0.25, 0.025, 2},
+	"gpt-5-nano":   {0.05, 0.005, 0.40},
+	"gpt-4.1":      {2, 0.50, 8},
+	"gpt-4.1-mini": {0.40, 0.10, 1.60},
+	"gpt-4.1-nano": {0.10, 0.025, 0.40},
+	"gpt-4o":       {2.50, 1.25, 10},
+	"gpt-4o-mini":  {0.15, 0.075, 0.60},
+}
+
+// PriceFor finds model's price in prices. An unknown model is priced as
+// the most expensive known one, so a budget cap errs on the safe side.
+func PriceFor(prices map[string]Price, model string) Price {
+	best, bestLen := Price{}, -1
+	for name, p := range prices {
+		if (model == name || strings.HasPrefix(model, name+"-")) && len(name) > bestLen {
+			best, bestLen = p, len(name)
+		}
+	}
+	if bestLen >= 0 {
+		return best
+	}
+	for _, p := range prices {
+		if p.Output > best.Output {
+			best = p
+		}
+	}
+	return best
+}
+
+// Cost is u's estimated price in USD.
+func (u Usage) Cost(prices map[string]Price) float64 {
+	p := PriceFor(prices, u.Model)
+	uncached := u.InputTokens - u.CachedTokens
+	return (float64(uncached)*p.Input + float64(u.CachedTokens)*p.CachedInput + float64(u.OutputTokens)*p.Output) / 1e6
+}
+
+// ParsePrices reads "model=input/cached/output,..." (USD per million
+// tokens) on top of Prices. Malformed entries are skipped.
+func ParsePrices(s string) map[string]Price {
+	out := make(map[string]Price, len(Prices))
+	for k, v := range Prices {
+		out[k] = v
+	}
+	for _, entry := range strings.Split(s, ",") {
+		model, spec, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok || model == "" {
+			continue
+		}
+		parts := strings.Split(spec, "/")
+		if len(parts) != 3 {
+			continue
+		}
+		var nums [3]float64
+		valid := true
+		for i, p := range parts {
+			f, err := strconv.ParseFloat(strings.TrimSpace(p), 64)
+			if err != nil || f < 0 {
+				valid = false
+				break
+			}
+			nums[i] = f
+		}
+		if valid {
+			out[model] = Price{nums[0], nums[1], nums[2]}
+		}
+	}
+	return out
+}
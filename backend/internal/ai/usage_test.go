@@ -0,0 +1,31 @@
+package ai
+
+import (
+	"math"
+	"testing"
+)
+
+func TestUsageCost(t *testing.T) {
+	prices := ParsePrices("house-model=1/0.5/4, broken=1/2")
+
+	u := Usage{Model: "house-model-2026-01-01", InputTokens: 3_000_000, CachedTokens: 1_000_000, OutputTokens: 500_000}
+	// 2M uncached at 1 + 1M cached at 0.5 + 0.5M output at 4.
+	if got := u.Cost(prices); math.Abs(got-4.5) > 1e-9 {
+		t.Errorf("cost = %v, want 4.5", got)
+	}
+
+	if _, ok := prices["broken"]; ok {
+		t.Error("malformed entry was kept")
+	}
+	if got := PriceFor(prices, "gpt-4o-mini-2024-07-18"); got != Prices["gpt-4o-mini"] {
+		t.Errorf("dated snapshot priced as %+v", got)
+	}
+
+	// Unknown models cost as much as the priciest known one.
+	unknown := PriceFor(prices, "mystery")
+	for name, p := range prices {
+		if p.Output > unknown.Output {
+			t.Errorf("unknown model priced below %s", name)
+		}
+	}
+}
@@ -2,7 +2,11 @@ package config
 
 import (
 	"os"
+	"strconv"
 	"strings"
+	"time"
+
+	"sliceapp-backend/internal/ai"
 )
 
 type Config struct {
@@ -12,6 +16,57 @@ type Config struct {
 	UseFakeAI   bool
 	OpenAIKey   string
 	OpenAIModel string
+
+	// RealtimePGNotify fans realtime events out through Postgres
+	// LISTEN/NOTIFY so every API instance sees them.
+	RealtimePGNotify bool
+
+	// TrashRetentionDays is how long a deleted plan stays restorable.
+	TrashRetentionDays int
+
+	// Rate limits, as requests per minute (0 = off). UserRatePerMinute is
+	// per X-User-Id, IPRatePerMinute per client IP for every route.
+	UserRatePerMinute int
+	IPRatePerMinute   int
+	// AnonUsersPerHour caps POST /auth/anonymous per client IP.
+	AnonUsersPerHour int
+	// AIDailyQuota is how many real AI generations a user gets per UTC
+	// day (0 = unlimited). Fake AI doesn't count.
+	AIDailyQuota int
+	// RateLimitPG keeps the token buckets in Postgres so every API
+	// instance shares them; otherwise each instance counts on its own.
+	RateLimitPG bool
+	// AIMonthlyBudgetUSD caps the estimated AI spend per calendar month
+	// (UTC; 0 = no cap). Past it, real AI calls go to AIBudgetFallback:
+	// "fake" for the fake splitter, or the name of a cheaper model.
+	AIMonthlyBudgetUSD float64
+	AIBudgetFallback   string
+	// AIPrices prices AI usage, USD per million tokens by model.
+	AIPrices map[string]ai.Price
+
+	// SplitterCache reuses splitter output for identical requests for
+	// SplitterCacheTTL, keeping up to SplitterCacheSize of them in memory.
+	// SplitterCachePG adds a Postgres tier shared by every instance.
+	SplitterCache     bool
+	SplitterCacheTTL  time.Duration
+	SplitterCacheSize int
+	SplitterCachePG   bool
+
+	// AdminUserIDs may read the /admin endpoints.
+	AdminUserIDs []string
+
+	// TrustProxy takes the client IP from X-Forwarded-For, as set by the
+	// load balancer in front, instead of the connection address.
+	TrustProxy bool
+}
+
+// envInt reads a non-negative int, falling back to def.
+func envInt(name string, def int) int {
+	v, err := strconv.Atoi(os.Getenv(name))
+	if err != nil || v < 0 {
+		return def
+	}
+	return v
 }
 
 func Load() Config {
@@ -26,6 +81,33 @@ func Load() Config {
 	}
 
 	useFake := strings.ToLower(os.Getenv("USE_FAKE_AI")) == "true"
+	pgNotify := strings.ToLower(os.Getenv("REALTIME_PG_NOTIFY")) == "true"
+	rateLimitPG := strings.ToLower(os.Getenv("RATE_LIMIT_PG")) == "true"
+	trustProxy := strings.ToLower(os.Getenv("TRUST_PROXY")) == "true"
+
+	budget, err := strconv.ParseFloat(os.Getenv("AI_MONTHLY_BUDGET_USD"), 64)
+	if err != nil || budget < 0 {
+		budget = 0
+	}
+	fallback := strings.TrimSpace(os.Getenv("AI_BUDGET_FALLBACK"))
+	if fallback == "" {
+		fallback = "fake"
+	}
+
+	splitterCache := strings.ToLower(os.Getenv("SPLITTER_CACHE")) == "true"
+	splitterCachePG := strings.ToLower(os.Getenv("SPLITTER_CACHE_PG")) == "true"
+
+	var admins []string
+	for _, id := range strings.Split(os.Getenv("ADMIN_USER_IDS"), ",") {
+		if id = strings.TrimSpace(id); id != "" {
+			admins = append(admins, strings.ToLower(id))
+		}
+	}
+
+	trashDays, err := strconv.Atoi(os.Getenv("TRASH_RETENTION_DAYS"))
+	if err != nil || trashDays <= 0 {
+		trashDays = 30
+	}
 
 	return Config{
 		Port:        port,
@@ -33,5 +115,25 @@ func Load() Config {
 		UseFakeAI:   useFake,
 		OpenAIKey:   os.Getenv("OPENAI_API_KEY"),
 		OpenAIModel: model,
+
+		RealtimePGNotify:   pgNotify,
+		TrashRetentionDays: trashDays,
+
+		UserRatePerMinute: envInt("RATE_LIMIT_USER_PER_MINUTE", 120),
+		IPRatePerMinute:   envInt("RATE_LIMIT_IP_PER_MINUTE", 300),
+		AnonUsersPerHour:  envInt("ANON_USERS_PER_HOUR", 10),
+		AIDailyQuota:      envInt("AI_DAILY_QUOTA", 20),
+		RateLimitPG:       rateLimitPG,
+		TrustProxy:        trustProxy,
+
+		AIMonthlyBudgetUSD: budget,
+		AIBudgetFallback:   fallback,
+		AIPrices:           ai.ParsePrices(os.Getenv("AI_PRICES")),
+		AdminUserIDs:       admins,
+
+		SplitterCache:     splitterCache,
+		SplitterCacheTTL:  time.Duration(envInt("SPLITTER_CACHE_TTL_HOURS", 24*7)) * time.Hour,
+		SplitterCacheSize: envInt("SPLITTER_CACHE_SIZE", 1000),
+		SplitterCachePG:   splitterCachePG,
 	}
 }
@@ -0,0 +1,45 @@
+package db
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// PurgeTrash hard-deletes plans that have been in the trash longer than
+// retention. Days, members and the rest go with them via cascade.
+func PurgeTrash(ctx context.Context, pool *pgxpool.Pool, retention time.Duration) (int64, error) {
+	tag, err := pool.Exec(ctx, `
+		delete from public.plans
+		where deleted_at is not null
+		  and deleted_at < now() - $1 * interval '1 second'
+	`, int64(retention.Seconds()))
+	if err != nil {
+		return 0, err
+	}
+	return tag.RowsAffected(), nil
+}
+
+// RunTrashPurge calls PurgeTrash every interval until ctx is done.
+func RunTrashPurge(ctx context.Context, pool *pgxpool.Pool, retention, every time.Duration) {
+	t := time.NewTicker(every)
+	defer t.Stop()
+	for {
+		pctx, cancel := context.WithTimeout(ctx, time.Minute)
+		n, err := PurgeTrash(pctx, pool, retention)
+		cancel()
+		if err != nil {
+			log.Printf("trash purge failed: %v", err)
+		} else if n > 0 {
+			log.Printf("trash purge removed %d plans", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
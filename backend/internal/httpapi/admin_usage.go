@@ -0,0 +1,148 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"sliceapp-backend/internal/config"
+)
+
+// requireAdmin lets through only the users in cfg.AdminUserIDs. It goes
+// after requireUserID.
+func requireAdmin(cfg config.Config) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			uid, ok := userIDFromCtx(r.Context())
+			if !ok || !slices.Contains(cfg.AdminUserIDs, uid.String()) {
+				httpError(w, "admin only", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+type UsageRow struct {
+	Day          string  `json:"day"` // YYYY-MM-DD, UTC
+	Model        string  `json:"model"`
+	Calls        int     `json:"calls"`
+	InputTokens  int64   `json:"input_tokens"`
+	CachedTokens int64   `json:"cached_tokens"`
+	OutputTokens int64   `json:"output_tokens"`
+	CostUSD      float64 `json:"cost_usd"`
+}
+
+type UsageReport struct {
+	From         string     `json:"from"`
+	To           string     `json:"to"`
+	Rows         []UsageRow `json:"rows"`
+	TotalCostUSD float64    `json:"total_cost_usd"`
+
+	// The current month against AI_MONTHLY_BUDGET_USD, whatever the range.
+	MonthCostUSD     float64 `json:"month_cost_usd"`
+	MonthlyBudgetUSD float64 `json:"monthly_budget_usd"`
+	BudgetReached    bool    `json:"budget_reached"`
+	Fallback         string  `json:"fallback,omitempty"`
+}
+
+// handleAdminUsage: GET /admin/usage?from=&to=&user_id=&plan_id= sums AI
+// usage by UTC day and model. from and to are inclusive dates and default
+// to the current month.
+func handleAdminUsage(db *pgxpool.Pool, cfg config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if db == nil {
+			httpError(w, "db not connected", http.StatusServiceUnavailable)
+			return
+		}
+
+		qs := r.URL.Query()
+		now := time.Now().UTC()
+		from := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+		to := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+		for name, dst := range map[string]*time.Time{"from": &from, "to": &to} {
+			if s := qs.Get(name); s != "" {
+				t, err := time.Parse("2006-01-02", s)
+				if err != nil {
+					httpError(w, "invalid "+name, http.StatusBadRequest)
+					return
+				}
+				*dst = t
+			}
+		}
+		if to.Before(from) {
+			httpError(w, "to is before from", http.StatusBadRequest)
+			return
+		}
+
+		var userID, planID *uuid.UUID
+		for name, dst := range map[string]**uuid.UUID{"user_id": &userID, "plan_id": &planID} {
+			if s := strings.TrimSpace(qs.Get(name)); s != "" {
+				id, err := uuid.Parse(s)
+				if err != nil {
+					httpError(w, "invalid "+name, http.StatusBadRequest)
+					return
+				}
+				*dst = &id
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+
+		rows, err := db.Query(ctx, `
+			select to_char((created_at at time zone 'utc')::date, 'YYYY-MM-DD'), model,
+			       count(*)::int, sum(input_tokens), sum(cached_tokens), sum(output_tokens),
+			       sum(cost_usd)::float8
+			from public.ai_usage
+			where created_at >= $1 and created_at < $2
+			  and ($3::uuid is null or user_id = $3)
+			  and ($4::uuid is null or plan_id = $4)
+			group by 1, 2
+			order by 1, 2
+		`, from, to.AddDate(0, 0, 1), userID, planID)
+		if err != nil {
+			internalError(w, "query failed", err)
+			return
+		}
+		defer rows.Close()
+
+		report := UsageReport{
+			From:             from.Format("2006-01-02"),
+			To:               to.Format("2006-01-02"),
+			Rows:             make([]UsageRow, 0),
+			MonthlyBudgetUSD: cfg.AIMonthlyBudgetUSD,
+		}
+		for rows.Next() {
+			var u UsageRow
+			if err := rows.Scan(&u.Day, &u.Model, &u.Calls, &u.InputTokens, &u.CachedTokens, &u.OutputTokens, &u.CostUSD); err != nil {
+				internalError(w, "scan failed", err)
+				return
+			}
+			report.TotalCostUSD += u.CostUSD
+			report.Rows = append(report.Rows, u)
+		}
+		if err := rows.Err(); err != nil {
+			internalError(w, "rows failed", err)
+			return
+		}
+
+		if report.MonthCostUSD, err = monthAISpend(ctx, db); err != nil {
+			internalError(w, "query failed", err)
+			return
+		}
+		if cfg.AIMonthlyBudgetUSD > 0 && report.MonthCostUSD >= cfg.AIMonthlyBudgetUSD {
+			report.BudgetReached = true
+			report.Fallback = cfg.AIBudgetFallback
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(report)
+	}
+}
@@ -0,0 +1,61 @@
+package httpapi
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"sliceapp-backend/internal/config"
+)
+
+// takeAIQuota spends one of uid's real AI generations for today (UTC).
+// It writes the response and returns false when they are used up. Call it
+// only on the real-AI path; fake AI is free.
+func takeAIQuota(ctx context.Context, w http.ResponseWriter, db *pgxpool.Pool, cfg config.Config, uid uuid.UUID) bool {
+	if cfg.AIDailyQuota <= 0 || db == nil {
+		return true
+	}
+	var used int
+	err := db.QueryRow(ctx, `
+		insert into public.ai_quota_usage as q (user_id, day, used)
+		values ($1, (now() at time zone 'utc')::date, 1)
+		on conflict (user_id, day) do update set used = q.used + 1
+		where q.used < $2
+		returning used
+	`, uid, cfg.AIDailyQuota).Scan(&used)
+	if errors.Is(err, pgx.ErrNoRows) {
+		now := time.Now().UTC()
+		midnight := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, time.UTC)
+		setRetryAfter(w, midnight.Sub(now))
+		writeAPIError(w, http.StatusTooManyRequests, APIError{
+			Code:    "ai_quota_exceeded",
+			Message: "daily AI generation limit reached",
+		})
+		return false
+	}
+	if err != nil {
+		internalError(w, "ai quota check failed", err)
+		return false
+	}
+	return true
+}
+
+// refundAIQuota gives back a generation that failed upstream, so errors
+// on the AI side don't use up the user's day.
+func refundAIQuota(ctx context.Context, db *pgxpool.Pool, cfg config.Config, uid uuid.UUID) {
+	if cfg.AIDailyQuota <= 0 || db == nil {
+		return
+	}
+	// The request's context may be what timed out.
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancel()
+	_, _ = db.Exec(ctx, `
+		update public.ai_quota_usage set used = used - 1
+		where user_id = $1 and day = (now() at time zone 'utc')::date and used > 0
+	`, uid)
+}
@@ -0,0 +1,89 @@
+package httpapi
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"sliceapp-backend/internal/ai"
+	"sliceapp-backend/internal/config"
+)
+
+// Operations recorded in ai_usage.
+const (
+	aiOpCreatePlan  = "create_plan"
+	aiOpGenerateDay = "generate_day"
+	aiOpShrinkDays  = "shrink_days"
+)
+
+func aiPrices(cfg config.Config) map[string]ai.Price {
+	if cfg.AIPrices != nil {
+		return cfg.AIPrices
+	}
+	return ai.Prices
+}
+
+// recordAIUsage stores what c spent on behalf of uid. planID may be "",
+// or a plan whose transaction didn't commit; either way plan_id is null.
+// Errors are only logged: the tokens are spent either way, and the
+// request shouldn't fail over bookkeeping.
+func recordAIUsage(ctx context.Context, db *pgxpool.Pool, cfg config.Config, uid uuid.UUID, planID, op string, c *ai.Client) {
+	if db == nil || c == nil || c.Usage.Empty() {
+		return
+	}
+	// The request's context may be what timed out.
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancel()
+
+	var plan *string
+	if planID != "" {
+		plan = &planID
+	}
+	u := c.Usage
+	_, err := db.Exec(ctx, `
+		insert into public.ai_usage
+		  (user_id, plan_id, operation, model, input_tokens, cached_tokens, output_tokens, cost_usd)
+		values ($1, (select id from public.plans where id = $2), $3, $4, $5, $6, $7, $8)
+	`, uid, plan, op, u.Model, u.InputTokens, u.CachedTokens, u.OutputTokens, u.Cost(aiPrices(cfg)))
+	if err != nil {
+		log.Printf("record ai usage (%s, %s): %v", op, u.Model, err)
+	}
+}
+
+// monthAISpend is the estimated AI spend of the current calendar month
+// (UTC), in USD.
+func monthAISpend(ctx context.Context, q querier) (float64, error) {
+	var spent float64
+	err := q.QueryRow(ctx, `
+		select coalesce(sum(cost_usd), 0)::float8
+		from public.ai_usage
+		where created_at >= date_trunc('month', now() at time zone 'utc') at time zone 'utc'
+	`).Scan(&spent)
+	return spent, err
+}
+
+// budgetedAI is cfg as this request's AI calls should see it: unchanged
+// under the monthly budget, switched to AIBudgetFallback once it is
+// spent. If the spend can't be read the budget isn't enforced.
+func budgetedAI(ctx context.Context, db *pgxpool.Pool, cfg config.Config) config.Config {
+	if cfg.UseFakeAI || cfg.AIMonthlyBudgetUSD <= 0 || db == nil {
+		return cfg
+	}
+	spent, err := monthAISpend(ctx, db)
+	if err != nil {
+		log.Printf("ai budget check failed: %v", err)
+		return cfg
+	}
+	if spent < cfg.AIMonthlyBudgetUSD {
+		return cfg
+	}
+	if cfg.AIBudgetFallback == "" || cfg.AIBudgetFallback == "fake" {
+		cfg.UseFakeAI = true
+	} else {
+		cfg.OpenAIModel = cfg.AIBudgetFallback
+	}
+	return cfg
+}
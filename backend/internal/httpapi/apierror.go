@@ -0,0 +1,77 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// APIError is the body of every error response, wrapped as
+// {"error": {...}}. Code is stable and meant for clients to switch on;
+// Message is for humans and may change.
+type APIError struct {
+	Code      string       `json:"code"`
+	Message   string       `json:"message"`
+	RequestID string       `json:"request_id,omitempty"`
+	Details   []FieldError `json:"details,omitempty"`
+}
+
+// errorCodes is the default code for each status httpError is used with.
+var errorCodes = map[int]string{
+	http.StatusBadRequest:            "bad_request",
+	http.StatusUnauthorized:          "unauthorized",
+	http.StatusForbidden:             "forbidden",
+	http.StatusNotFound:              "not_found",
+	http.StatusConflict:              "conflict",
+	http.StatusGone:                  "gone",
+	http.StatusPreconditionFailed:    "precondition_failed",
+	http.StatusRequestEntityTooLarge: "body_too_large",
+	http.StatusUnsupportedMediaType:  "unsupported_media_type",
+	http.StatusUnprocessableEntity:   "unprocessable",
+	http.StatusPreconditionRequired:  "precondition_required",
+	http.StatusTooManyRequests:       "rate_limited",
+	http.StatusInternalServerError:   "internal",
+	http.StatusBadGateway:            "upstream_failed",
+	http.StatusServiceUnavailable:    "unavailable",
+}
+
+func errorCode(status int) string {
+	if code, ok := errorCodes[status]; ok {
+		return code
+	}
+	if status >= 500 {
+		return "internal"
+	}
+	return "bad_request"
+}
+
+// writeAPIError renders e with status, filling in the request id.
+func writeAPIError(w http.ResponseWriter, status int, e APIError) {
+	if e.Code == "" {
+		e.Code = errorCode(status)
+	}
+	e.RequestID = w.Header().Get(requestIDHeader)
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Del("Content-Length")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]any{"error": e})
+}
+
+// httpError is the JSON counterpart of http.Error. msg goes to the client
+// as is, so it must never contain an err.Error().
+func httpError(w http.ResponseWriter, msg string, status int) {
+	writeAPIError(w, status, APIError{Message: msg})
+}
+
+// internalError logs err with the request id and answers 500 with msg
+// only.
+func internalError(w http.ResponseWriter, msg string, err error) {
+	log.Printf("[%s] %s: %v", w.Header().Get(requestIDHeader), msg, err)
+	httpError(w, msg, http.StatusInternalServerError)
+}
+
+// upstreamError is internalError for failures of the AI service: 502.
+func upstreamError(w http.ResponseWriter, msg string, err error) {
+	log.Printf("[%s] %s: %v", w.Header().Get(requestIDHeader), msg, err)
+	httpError(w, msg, http.StatusBadGateway)
+}
@@ -23,7 +23,7 @@ func handleAnonymousUser(db *pgxpool.Pool) http.HandlerFunc {
 
 		_, err := db.Exec(ctx, `insert into public.users (id) values ($1) on conflict (id) do nothing`, id)
 		if err != nil {
-			http.Error(w, "failed to create user", http.StatusInternalServerError)
+			internalError(w, "failed to create user", err)
 			return
 		}
 
@@ -0,0 +1,138 @@
+package httpapi
+
+import (
+	"math"
+	"strings"
+)
+
+// minutesBudget splits D daily minutes into CORE / MOMENTUM / BAD DAY using
+// the splitter's Minutes Budget Rule (see ai.BuildSplitterPrompt), so plans
+// built without the AI follow the same shape as AI plans.
+func minutesBudget(D int) (core, mom, bad int) {
+	bad = clampInt(int(math.Round(float64(D)*0.15)), 3, 10)
+	mom = clampInt(int(math.Round(float64(D)*0.25)), 10, 25)
+	core = D - bad - mom
+	if core < 10 {
+		need := 10 - core
+		mom -= need
+		if mom < 10 {
+			mom = 10
+		}
+		core = D - bad - mom
+	}
+
+	// Very small budgets can't honour the floors above; fall back to 15%
+	// BAD DAY and 25% MOMENTUM, rounded down but at least a minute each,
+	// with CORE taking the rest so the parts still sum to D.
+	if core < 1 && D >= 3 {
+		bad = max(1, D*15/100)
+		mom = max(1, D*25/100)
+		core = D - bad - mom
+	}
+	return core, mom, bad
+}
+
+// stepSlot tells which budget slot a step fills, from its title tag.
+// Returns "" for untagged steps.
+func stepSlot(title string) string {
+	t := strings.ToUpper(title)
+	switch {
+	case strings.Contains(t, "[CORE]"):
+		return "core"
+	case strings.Contains(t, "[MOMENTUM]"):
+		return "momentum"
+	case strings.Contains(t, "[BAD DAY]"), strings.Contains(t, "[BAD_DAY]"):
+		return "bad_day"
+	}
+	return ""
+}
+
+// rebalanceSteps returns a copy of steps whose minutes sum to D.
+// The usual 3-step day gets CORE/MOMENTUM/BAD DAY minutes from
+// minutesBudget (by title tag, falling back to position). Any other shape
+// is rescaled proportionally to the current minutes.
+func rebalanceSteps(steps []PlanDayStep, D int) []PlanDayStep {
+	out := make([]PlanDayStep, len(steps))
+	copy(out, steps)
+	if len(out) == 0 || D <= 0 {
+		return out
+	}
+
+	if len(out) == 3 {
+		core, mom, bad := minutesBudget(D)
+		bySlot := map[string]int{"core": core, "momentum": mom, "bad_day": bad}
+		byPos := []int{core, mom, bad}
+
+		seen := map[string]bool{}
+		tagged := true
+		for _, s := range out {
+			slot := stepSlot(s.Title)
+			if slot == "" || seen[slot] {
+				tagged = false
+				break
+			}
+			seen[slot] = true
+		}
+		for i := range out {
+			if tagged {
+				out[i].Minutes = bySlot[stepSlot(out[i].Title)]
+			} else {
+				out[i].Minutes = byPos[i]
+			}
+		}
+		return out
+	}
+
+	// Proportional rescale with largest-remainder rounding, each step >= 1.
+	total := 0
+	for _, s := range out {
+		if s.Minutes > 0 {
+			total += s.Minutes
+		}
+	}
+	weights := make([]float64, len(out))
+	for i, s := range out {
+		if total > 0 {
+			weights[i] = float64(max(s.Minutes, 0)) / float64(total)
+		} else {
+			weights[i] = 1 / float64(len(out))
+		}
+	}
+
+	assigned := 0
+	rem := make([]float64, len(out))
+	for i, wgt := range weights {
+		exact := wgt * float64(D)
+		out[i].Minutes = int(math.Floor(exact))
+		rem[i] = exact - float64(out[i].Minutes)
+		assigned += out[i].Minutes
+	}
+	for assigned < D {
+		best := 0
+		for i := range rem {
+			if rem[i] > rem[best] {
+				best = i
+			}
+		}
+		out[best].Minutes++
+		rem[best] = -1
+		assigned++
+	}
+	// Lift zero-minute steps by borrowing from the largest one.
+	for i := range out {
+		for out[i].Minutes < 1 {
+			big := 0
+			for j := range out {
+				if out[j].Minutes > out[big].Minutes {
+					big = j
+				}
+			}
+			if out[big].Minutes <= 1 {
+				break
+			}
+			out[big].Minutes--
+			out[i].Minutes++
+		}
+	}
+	return out
+}
@@ -0,0 +1,76 @@
+package httpapi
+
+import "testing"
+
+func TestMinutesBudget(t *testing.T) {
+	cases := []struct {
+		d              int
+		core, mom, bad int
+	}{
+		{3, 1, 1, 1},   // too small for the floors: fallback split
+		{10, 7, 2, 1},  // still below the floors
+		{20, 7, 10, 3}, // BAD DAY clamped up to 3
+		{30, 15, 10, 5},
+		{60, 36, 15, 9},
+		{90, 57, 23, 10},  // BAD DAY clamped down to 10
+		{120, 85, 25, 10}, // BAD DAY clamped down to 10, MOMENTUM to 25
+		{240, 205, 25, 10},
+	}
+	for _, c := range cases {
+		core, mom, bad := minutesBudget(c.d)
+		if core != c.core || mom != c.mom || bad != c.bad {
+			t.Errorf("minutesBudget(%d) = %d/%d/%d, want %d/%d/%d", c.d, core, mom, bad, c.core, c.mom, c.bad)
+		}
+		if core+mom+bad != c.d {
+			t.Errorf("minutesBudget(%d) sums to %d", c.d, core+mom+bad)
+		}
+	}
+	for d := 20; d <= 600; d++ {
+		_, _, bad := minutesBudget(d)
+		if bad < 3 || bad > 10 {
+			t.Fatalf("minutesBudget(%d): bad day %d outside 3..10", d, bad)
+		}
+	}
+}
+
+func TestRebalanceSteps(t *testing.T) {
+	steps := func(titles ...string) []PlanDayStep {
+		out := make([]PlanDayStep, len(titles))
+		for i, title := range titles {
+			out[i] = PlanDayStep{Title: title, Minutes: 10}
+		}
+		return out
+	}
+	cases := []struct {
+		name  string
+		steps []PlanDayStep
+		d     int
+		want  []int
+	}{
+		{"three untagged by position", steps("a", "b", "c"), 60, []int{36, 15, 9}},
+		{"three tagged by slot", steps("[BAD DAY] c", "[CORE] a", "[MOMENTUM] b"), 60, []int{9, 36, 15}},
+		{"duplicate tag falls back to position", steps("[CORE] a", "[CORE] b", "[BAD DAY] c"), 60, []int{36, 15, 9}},
+		{"proportional keeps ratios", []PlanDayStep{{Minutes: 10}, {Minutes: 30}}, 80, []int{20, 60}},
+		{"remainders add up", []PlanDayStep{{Minutes: 1}, {Minutes: 1}, {Minutes: 1}, {Minutes: 1}}, 10, []int{3, 3, 2, 2}},
+		{"zero weights split evenly", []PlanDayStep{{}, {}}, 7, []int{4, 3}},
+		{"every step gets a minute", []PlanDayStep{{Minutes: 100}, {Minutes: 0}}, 5, []int{4, 1}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := rebalanceSteps(c.steps, c.d)
+			if len(got) != len(c.want) {
+				t.Fatalf("got %d steps, want %d", len(got), len(c.want))
+			}
+			sum := 0
+			for i, s := range got {
+				if s.Minutes != c.want[i] {
+					t.Errorf("step %d = %d minutes, want %d", i, s.Minutes, c.want[i])
+				}
+				sum += s.Minutes
+			}
+			if sum != c.d {
+				t.Errorf("minutes sum to %d, want %d", sum, c.d)
+			}
+		})
+	}
+}
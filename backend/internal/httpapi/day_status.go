@@ -0,0 +1,59 @@
+package httpapi
+
+const (
+	dayPending = "pending"
+	dayDone    = "done"
+	dayBadDay  = "bad_day"
+	daySkipped = "skipped"
+)
+
+var dayStatuses = map[string]bool{
+	dayPending: true,
+	dayDone:    true,
+	dayBadDay:  true,
+	daySkipped: true,
+}
+
+// dayCountsDone: a bad day (only the BAD DAY step) still counts, which is
+// the point of having one.
+func dayCountsDone(status string) bool {
+	return status == dayDone || status == dayBadDay
+}
+
+// scheduledDay is one plan day placed on the pause-aware calendar.
+type scheduledDay struct {
+	DayNumber int
+	Status    string
+	// Slot is the calendar day (1 = the plan's first day) the day is due.
+	// Every skip of this or an earlier day pushes it one slot later.
+	Slot int
+}
+
+type dayRow struct {
+	DayNumber int
+	Status    string
+	SkipCount int
+}
+
+// scheduleDays assigns calendar slots to days (ordered by day_number).
+func scheduleDays(days []dayRow) []scheduledDay {
+	out := make([]scheduledDay, 0, len(days))
+	pushed := 0
+	for _, d := range days {
+		pushed += d.SkipCount
+		out = append(out, scheduledDay{DayNumber: d.DayNumber, Status: d.Status, Slot: d.DayNumber + pushed})
+	}
+	return out
+}
+
+// todayDay is the plan day due on calendar day clock: the last day whose
+// slot has arrived.
+func todayDay(sched []scheduledDay, clock int) int {
+	today := 1
+	for _, d := range sched {
+		if d.Slot <= clock {
+			today = d.DayNumber
+		}
+	}
+	return today
+}
@@ -0,0 +1,61 @@
+package httpapi
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestScheduleDays(t *testing.T) {
+	cases := []struct {
+		name  string
+		days  []dayRow
+		slots []int
+	}{
+		{"empty", nil, []int{}},
+		{"no skips", []dayRow{{1, dayDone, 0}, {2, dayPending, 0}, {3, dayPending, 0}}, []int{1, 2, 3}},
+		{"skip pushes itself and later days", []dayRow{{1, dayDone, 0}, {2, daySkipped, 1}, {3, dayPending, 0}}, []int{1, 3, 4}},
+		{"skips add up", []dayRow{{1, daySkipped, 2}, {2, daySkipped, 1}, {3, dayPending, 0}}, []int{3, 5, 6}},
+		{"count kept after unskip", []dayRow{{1, dayDone, 1}, {2, dayPending, 0}}, []int{2, 3}},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			sched := scheduleDays(c.days)
+			slots := make([]int, 0, len(sched))
+			for i, d := range sched {
+				if d.DayNumber != c.days[i].DayNumber || d.Status != c.days[i].Status {
+					t.Errorf("day %d: got %d/%s", i, d.DayNumber, d.Status)
+				}
+				slots = append(slots, d.Slot)
+			}
+			if !slices.Equal(slots, c.slots) {
+				t.Errorf("slots = %v, want %v", slots, c.slots)
+			}
+		})
+	}
+}
+
+func TestTodayDay(t *testing.T) {
+	// Slots 1, 3, 4: day 2 was skipped once.
+	sched := scheduleDays([]dayRow{{1, dayDone, 0}, {2, daySkipped, 1}, {3, dayPending, 0}})
+	cases := []struct {
+		name  string
+		sched []scheduledDay
+		clock int
+		want  int
+	}{
+		{"no days", nil, 5, 1},
+		{"before the start", sched, 0, 1},
+		{"first day", sched, 1, 1},
+		{"skipped slot stays on previous day", sched, 2, 1},
+		{"pushed day arrives", sched, 3, 2},
+		{"last day", sched, 4, 3},
+		{"past the end", sched, 10, 3},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := todayDay(c.sched, c.clock); got != c.want {
+				t.Errorf("todayDay(clock %d) = %d, want %d", c.clock, got, c.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,38 @@
+package httpapi
+
+import (
+	"net/http"
+	"strings"
+)
+
+const (
+	apiPrefix = "/v1"
+
+	// legacyDeprecatedAt is when the unversioned routes were superseded by
+	// /v1, as an RFC 9745 date (2026-10-19T00:00:00Z).
+	legacyDeprecatedAt = "@1792368000"
+)
+
+// deprecatedAlias marks the unversioned routes, which behave exactly like
+// their /v1 counterparts. The Deprecation and Link headers tell clients
+// where to move.
+func deprecatedAlias(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		successor := apiPrefix + r.URL.EscapedPath()
+		if r.URL.RawQuery != "" {
+			successor += "?" + r.URL.RawQuery
+		}
+		w.Header().Set("Deprecation", legacyDeprecatedAt)
+		w.Header().Add("Link", "<"+successor+`>; rel="successor-version"`)
+		next.ServeHTTP(w, r)
+	})
+}
+
+// legacyPath is the deprecated alias of a /v1 path, or "" for paths that
+// were never versioned.
+func legacyPath(p string) string {
+	if rest, ok := strings.CutPrefix(p, apiPrefix+"/"); ok {
+		return "/" + rest
+	}
+	return ""
+}
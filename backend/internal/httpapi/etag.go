@@ -0,0 +1,103 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// planETag renders plans.version as a strong ETag, e.g. "v7".
+func planETag(version int) string {
+	return `"v` + strconv.Itoa(version) + `"`
+}
+
+// etagMatches reports whether an If-Match / If-None-Match header value
+// names version. "*" matches anything. A bare version number (7 or v7) is
+// accepted too, since mobile clients often strip the quotes. With strong
+// set, as If-Match requires (RFC 9110 13.1.1), a weak tag (W/"v7") never
+// matches; If-None-Match compares weakly and accepts it.
+func etagMatches(header string, version int, strong bool) bool {
+	header = strings.TrimSpace(header)
+	if header == "" {
+		return false
+	}
+	if header == "*" {
+		return true
+	}
+	want := strconv.Itoa(version)
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if strings.HasPrefix(tag, "W/") {
+			if strong {
+				continue
+			}
+			tag = strings.TrimPrefix(tag, "W/")
+		}
+		tag = strings.Trim(tag, `"`)
+		tag = strings.TrimPrefix(tag, "v")
+		if tag == want {
+			return true
+		}
+	}
+	return false
+}
+
+// lockPlanVersion locks the plan row for the rest of tx and returns its
+// current version.
+func lockPlanVersion(ctx context.Context, q querier, planID string) (int, error) {
+	var v int
+	err := q.QueryRow(ctx, `
+		select version from public.plans where id = $1 for update
+	`, planID).Scan(&v)
+	return v, err
+}
+
+// touchPlan bumps the plan's version after a change to it or its days.
+func touchPlan(ctx context.Context, q querier, planID string) (int, error) {
+	var v int
+	err := q.QueryRow(ctx, `
+		update public.plans set version = version + 1
+		where id = $1
+		returning version
+	`, planID).Scan(&v)
+	return v, err
+}
+
+// checkIfMatch locks the plan and enforces If-Match when the client sent
+// one. On a stale version it answers 412 with the current plan so the app
+// can offer a merge, and returns false. Without If-Match the write goes
+// through (last write wins, as before).
+func checkIfMatch(ctx context.Context, w http.ResponseWriter, r *http.Request, q querier, planID string) bool {
+	version, err := lockPlanVersion(ctx, q, planID)
+	if err != nil {
+		httpError(w, "plan not found", http.StatusNotFound)
+		return false
+	}
+
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch == "" || etagMatches(ifMatch, version, true) {
+		return true
+	}
+
+	current, err := loadPlanDetail(ctx, q, planID)
+	if err != nil {
+		log.Printf("load plan for 412 failed: %v", err)
+		httpError(w, "precondition failed", http.StatusPreconditionFailed)
+		return false
+	}
+	w.Header().Set("ETag", planETag(current.Version))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusPreconditionFailed)
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"error": APIError{
+			Code:      "version_mismatch",
+			Message:   "plan was changed by someone else",
+			RequestID: w.Header().Get(requestIDHeader),
+		},
+		"current": current,
+	})
+	return false
+}
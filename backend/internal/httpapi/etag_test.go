@@ -0,0 +1,28 @@
+package httpapi
+
+import "testing"
+
+func TestETagMatches(t *testing.T) {
+	cases := []struct {
+		header string
+		strong bool
+		want   bool
+	}{
+		{`"v7"`, true, true},
+		{`"v7"`, false, true},
+		{`"v6", "v7"`, true, true},
+		{`"v8"`, true, false},
+		{`*`, true, true},
+		{``, true, false},
+		{`v7`, true, true}, // quotes stripped by the client
+		{`7`, true, true},
+		{`W/"v7"`, true, false}, // If-Match never matches a weak tag
+		{`W/"v7"`, false, true},
+		{`W/"v7", "v7"`, true, true},
+	}
+	for _, c := range cases {
+		if got := etagMatches(c.header, 7, c.strong); got != c.want {
+			t.Errorf("etagMatches(%q, 7, strong=%v) = %v, want %v", c.header, c.strong, got, c.want)
+		}
+	}
+}
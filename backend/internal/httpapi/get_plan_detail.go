@@ -3,11 +3,14 @@ package httpapi
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
 	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -16,83 +19,119 @@ type PlanDetailResponse struct {
 	Title        string    `json:"title"`
 	Days         int       `json:"days"`
 	DailyMinutes int       `json:"daily_minutes"`
+	GoalType     string    `json:"goal_type,omitempty"`
+	Status       string    `json:"status,omitempty"`
+	SourcePlanID *string   `json:"source_plan_id,omitempty"`
 	CreatedAt    time.Time `json:"created_at"`
+	Role         string    `json:"role,omitempty"`
+	Version      int       `json:"version,omitempty"`
 	Items        []PlanDay `json:"items"`
 }
 
+// loadPlanDetail reads a plan with all its days. It does no permission
+// check; callers do that first.
+func loadPlanDetail(ctx context.Context, q querier, planID string) (PlanDetailResponse, error) {
+	var resp PlanDetailResponse
+	err := q.QueryRow(ctx, `
+		select id, title, days, daily_minutes, coalesce(goal_type, ''), status, source_plan_id, created_at, version
+		from public.plans
+		  where id = $1
+	`, planID).Scan(&resp.ID, &resp.Title, &resp.Days, &resp.DailyMinutes, &resp.GoalType, &resp.Status, &resp.SourcePlanID, &resp.CreatedAt, &resp.Version)
+	if err != nil {
+		return resp, err
+	}
+
+	items, err := loadPlanDays(ctx, q, planID)
+	if err != nil {
+		return resp, err
+	}
+	resp.Items = items
+	return resp, nil
+}
+
 func handleGetPlan(db *pgxpool.Pool) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if db == nil {
-			http.Error(w, "db not connected", http.StatusServiceUnavailable)
+			httpError(w, "db not connected", http.StatusServiceUnavailable)
 			return
 		}
 		uid, ok := userIDFromCtx(r.Context())
 		if !ok {
-			http.Error(w, "missing user", http.StatusUnauthorized)
+			httpError(w, "missing user", http.StatusUnauthorized)
 			return
 		}
 
 		planID := chi.URLParam(r, "id")
 		if planID == "" {
-			http.Error(w, "missing id", http.StatusBadRequest)
+			httpError(w, "missing id", http.StatusBadRequest)
 			return
 		}
 
 		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
 		defer cancel()
 
-		var resp PlanDetailResponse
-		err := db.QueryRow(ctx, `
-			select id, title, days, daily_minutes, created_at
-			from public.plans
-			  where id = $1 and user_id = $2
-		`, planID, uid).Scan(&resp.ID, &resp.Title, &resp.Days, &resp.DailyMinutes, &resp.CreatedAt)
+		role, ok := requirePlanRole(ctx, w, db, planID, uid, roleViewer)
+		if !ok {
+			return
+		}
 
+		resp, err := loadPlanDetail(ctx, db, planID)
 		if err != nil {
-			http.Error(w, "plan not found", http.StatusNotFound)
+			if errors.Is(err, pgx.ErrNoRows) {
+				httpError(w, "plan not found", http.StatusNotFound)
+				return
+			}
+			internalError(w, "query plan_days failed", err)
 			return
 		}
+		resp.Role = string(role)
 
-		rows, err := db.Query(ctx, `
-		select d.day_number, d.focus, d.steps, d.is_done
-		from public.plan_days d
-		join public.plans p on p.id = d.plan_id
-		where d.plan_id = $1 and p.user_id = $2
-		order by d.day_number asc
-		`, planID, uid)
-		if err != nil {
-			log.Printf("query plan_days failed: %v", err)
-			http.Error(w, "query plan_days failed", http.StatusInternalServerError)
+		etag := planETag(resp.Version)
+		w.Header().Set("ETag", etag)
+		if etagMatches(r.Header.Get("If-None-Match"), resp.Version, false) {
+			w.WriteHeader(http.StatusNotModified)
 			return
 		}
-		defer rows.Close()
 
-		items := make([]PlanDay, 0)
-		for rows.Next() {
-			var dayNumber int
-			var focus string
-			var stepsRaw []byte
-			var isDone bool
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(resp)
+	}
+}
 
-			if err := rows.Scan(&dayNumber, &focus, &stepsRaw, &isDone); err != nil {
-				http.Error(w, "scan failed", http.StatusInternalServerError)
-				return
-			}
+// querier is the subset of pgxpool.Pool / pgx.Tx used by shared helpers.
+type querier interface {
+	Exec(ctx context.Context, sql string, args ...any) (pgconn.CommandTag, error)
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
 
-			var steps []PlanDayStep
-			_ = json.Unmarshal(stepsRaw, &steps)
+// loadPlanDays reads every day of a plan in order.
+// Callers must check that the requester is allowed to see the plan.
+func loadPlanDays(ctx context.Context, q querier, planID string) ([]PlanDay, error) {
+	rows, err := q.Query(ctx, `
+		select day_number, focus, steps, is_done, status
+		from public.plan_days
+		where plan_id = $1
+		order by day_number asc
+	`, planID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
 
-			items = append(items, PlanDay{
-				DayNumber: dayNumber,
-				Focus:     focus,
-				Steps:     steps,
-				IsDone:    isDone,
-			})
+	items := make([]PlanDay, 0)
+	for rows.Next() {
+		var d PlanDay
+		var stepsRaw []byte
+		if err := rows.Scan(&d.DayNumber, &d.Focus, &stepsRaw, &d.IsDone, &d.Status); err != nil {
+			return nil, err
 		}
-
-		resp.Items = items
-
-		w.Header().Set("Content-Type", "application/json")
-		_ = json.NewEncoder(w).Encode(resp)
+		if err := json.Unmarshal(stepsRaw, &d.Steps); err != nil {
+			// Rows written before steps were validated can be malformed;
+			// serve the day without them rather than failing the plan.
+			log.Printf("plan %s day %d: bad steps json: %v", planID, d.DayNumber, err)
+		}
+		items = append(items, d)
 	}
+	return items, rows.Err()
 }
@@ -2,10 +2,15 @@ package httpapi
 
 import (
 	"context"
+	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -14,34 +19,182 @@ type PlanListItem struct {
 	Title        string    `json:"title"`
 	Days         int       `json:"days"`
 	DailyMinutes int       `json:"daily_minutes"`
+	GoalType     string    `json:"goal_type,omitempty"`
+	Status       string    `json:"status"`
 	CreatedAt    time.Time `json:"created_at"`
+	Role         string    `json:"role"`
+	DaysDone     int       `json:"days_done"`
+	DaysTotal    int       `json:"days_total"`
+	Tags         []TagRef  `json:"tags"`
 }
 
+// planCursor is the position after the last item of a page. Plans are
+// ordered by (created_at, id) descending, so both are needed to break ties.
+type planCursor struct {
+	CreatedAt time.Time
+	ID        uuid.UUID
+}
+
+func (c planCursor) encode() string {
+	raw := c.CreatedAt.UTC().Format(time.RFC3339Nano) + "|" + c.ID.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func parsePlanCursor(s string) (*planCursor, error) {
+	if s == "" {
+		return nil, nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+	ts, id, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return nil, errors.New("invalid cursor")
+	}
+	var c planCursor
+	if c.CreatedAt, err = time.Parse(time.RFC3339Nano, ts); err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+	if c.ID, err = uuid.Parse(id); err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+	return &c, nil
+}
+
+// parseDateParam accepts RFC 3339 or a bare YYYY-MM-DD (midnight UTC).
+func parseDateParam(s string) (*time.Time, error) {
+	if s == "" {
+		return nil, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return &t, nil
+	}
+	t, err := time.Parse("2006-01-02", s)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// handleListPlans: GET /plans, newest first.
+//
+//	?status=     comma-separated statuses, or "all"; default leaves out archived
+//	?goal_type=  one of the goal types
+//	?from=, ?to= created_at range, RFC 3339 or YYYY-MM-DD; to is exclusive
+//	?q=          full-text search over title, day focus and step text
+//	?tag=        one of the caller's tags, by id or name
+//	?cursor=     next_cursor from the previous page; ?limit= caps (default 50)
 func handleListPlans(db *pgxpool.Pool) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if db == nil {
-			http.Error(w, "db not connected", http.StatusServiceUnavailable)
+			httpError(w, "db not connected", http.StatusServiceUnavailable)
 			return
 		}
 
 		uid, ok := userIDFromCtx(r.Context())
 		if !ok {
-			http.Error(w, "missing user", http.StatusUnauthorized)
+			httpError(w, "missing user", http.StatusUnauthorized)
+			return
+		}
+
+		qs := r.URL.Query()
+
+		statuses := []string{statusActive, statusPaused, statusCompleted}
+		if s := qs.Get("status"); s == "all" {
+			statuses = []string{statusActive, statusPaused, statusArchived, statusCompleted}
+		} else if s != "" {
+			statuses = strings.Split(s, ",")
+			for _, st := range statuses {
+				if !planStatuses[st] {
+					httpError(w, "invalid status", http.StatusBadRequest)
+					return
+				}
+			}
+		}
+
+		goalType := qs.Get("goal_type")
+		if goalType != "" && !goalTypes[goalType] {
+			httpError(w, "invalid goal_type", http.StatusBadRequest)
+			return
+		}
+
+		from, err := parseDateParam(qs.Get("from"))
+		if err != nil {
+			httpError(w, "invalid from", http.StatusBadRequest)
+			return
+		}
+		to, err := parseDateParam(qs.Get("to"))
+		if err != nil {
+			httpError(w, "invalid to", http.StatusBadRequest)
+			return
+		}
+
+		search := strings.TrimSpace(qs.Get("q"))
+		tagFilter := strings.TrimSpace(qs.Get("tag"))
+
+		cursor, err := parsePlanCursor(qs.Get("cursor"))
+		if err != nil {
+			httpError(w, "invalid cursor", http.StatusBadRequest)
 			return
 		}
+		var afterTime *time.Time
+		var afterID *uuid.UUID
+		if cursor != nil {
+			afterTime, afterID = &cursor.CreatedAt, &cursor.ID
+		}
+
+		limit := 50
+		if v := qs.Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				httpError(w, "invalid limit", http.StatusBadRequest)
+				return
+			}
+			limit = clampInt(n, 1, 100)
+		}
 
 		ctx, cancel := context.WithTimeout(r.Context(), 8*time.Second)
 		defer cancel()
 
+		// One extra row tells us whether there is a next page.
 		rows, err := db.Query(ctx, `
-			select id, title, days, daily_minutes, created_at
-			from public.plans
-			where user_id = $1
-			order by created_at desc
-			limit 50
-		`, uid)
+			select p.id, p.title, p.days, p.daily_minutes, coalesce(p.goal_type, ''), p.status,
+			       p.created_at, m.role, coalesce(prog.done, 0), coalesce(prog.total, 0),
+			       coalesce((
+			         select jsonb_agg(jsonb_build_object('id', t.id, 'name', t.name, 'color', t.color)
+			                          order by lower(t.name))
+			         from public.plan_tags pt
+			         join public.tags t on t.id = pt.tag_id
+			         where pt.plan_id = p.id and t.user_id = $1
+			       ), '[]'::jsonb)
+			from public.plans p
+			join public.plan_members m on m.plan_id = p.id
+			left join lateral (
+				select count(*) filter (where d.is_done) as done, count(*) as total
+				from public.plan_days d
+				where d.plan_id = p.id
+			) prog on true
+			where m.user_id = $1 and p.deleted_at is null
+			  and p.status = any($2)
+			  and ($3 = '' or p.goal_type = $3)
+			  and ($4::timestamptz is null or p.created_at >= $4)
+			  and ($5::timestamptz is null or p.created_at < $5)
+			  and ($6 = '' or exists (
+			        select 1 from public.plan_search s
+			        where s.plan_id = p.id
+			          and s.tsv @@ websearch_to_tsquery('simple', $6)))
+			  and ($7::timestamptz is null or (p.created_at, p.id) < ($7, $8::uuid))
+			  and ($10 = '' or exists (
+			        select 1 from public.plan_tags pt
+			        join public.tags t on t.id = pt.tag_id
+			        where pt.plan_id = p.id and t.user_id = $1
+			          and (t.id::text = $10 or lower(t.name) = lower($10))))
+			order by p.created_at desc, p.id desc
+			limit $9
+		`, uid, statuses, goalType, from, to, search, afterTime, afterID, limit+1, tagFilter)
 		if err != nil {
-			http.Error(w, "query failed", http.StatusInternalServerError)
+			internalError(w, "query failed", err)
 			return
 		}
 		defer rows.Close()
@@ -49,14 +202,29 @@ func handleListPlans(db *pgxpool.Pool) http.HandlerFunc {
 		out := make([]PlanListItem, 0)
 		for rows.Next() {
 			var it PlanListItem
-			if err := rows.Scan(&it.ID, &it.Title, &it.Days, &it.DailyMinutes, &it.CreatedAt); err != nil {
-				http.Error(w, "scan failed", http.StatusInternalServerError)
+			if err := rows.Scan(&it.ID, &it.Title, &it.Days, &it.DailyMinutes, &it.GoalType, &it.Status, &it.CreatedAt, &it.Role, &it.DaysDone, &it.DaysTotal, &it.Tags); err != nil {
+				internalError(w, "scan failed", err)
 				return
 			}
 			out = append(out, it)
 		}
+		if err := rows.Err(); err != nil {
+			internalError(w, "rows error", err)
+			return
+		}
+
+		nextCursor := ""
+		if len(out) > limit {
+			out = out[:limit]
+			last := out[limit-1]
+			id, _ := uuid.Parse(last.ID)
+			nextCursor = planCursor{CreatedAt: last.CreatedAt, ID: id}.encode()
+		}
 
 		w.Header().Set("Content-Type", "application/json")
-		_ = json.NewEncoder(w).Encode(map[string]any{"plans": out})
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"plans":       out,
+			"next_cursor": nextCursor,
+		})
 	}
 }
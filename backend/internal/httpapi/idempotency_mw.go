@@ -0,0 +1,249 @@
+package httpapi
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	maxIdempotencyKeyLen = 255
+	maxIdempotentBody    = 1 << 20
+
+	// Keys are remembered this long, then the same key starts a new request.
+	idempotencyTTL = 24 * time.Hour
+	// An unfinished entry older than this is treated as abandoned (e.g. the
+	// server restarted mid-request) so the client can retry.
+	idempotencyInFlightTTL = 2 * time.Minute
+)
+
+// Response headers worth replaying; everything else is per-response.
+var replayHeaders = []string{"Content-Type", "ETag", "Location"}
+
+// captureWriter passes the response through and keeps a copy for storage.
+type captureWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (c *captureWriter) WriteHeader(code int) {
+	if c.status == 0 {
+		c.status = code
+	}
+	c.ResponseWriter.WriteHeader(code)
+}
+
+func (c *captureWriter) Write(b []byte) (int, error) {
+	if c.status == 0 {
+		c.status = http.StatusOK
+	}
+	c.body.Write(b)
+	return c.ResponseWriter.Write(b)
+}
+
+func requestHash(r *http.Request, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(r.Method))
+	h.Write([]byte{0})
+	h.Write([]byte(r.URL.Path))
+	h.Write([]byte{0})
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// idempotency makes mutating requests that carry an Idempotency-Key safe to
+// retry. The first response per (user, key) is stored; a retry with the
+// same method, path and body gets that response back with
+// Idempotent-Replayed: true. Reusing a key for a different request is a
+// 422, and a retry while the first attempt is still running is a 409.
+// Only successes and errors a retry can't change are stored; anything
+// else (a 409, 412, 429 or 5xx) frees the key so it can be retried for real.
+// Must run after requireUserID.
+func idempotency(db *pgxpool.Pool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := r.Header.Get("Idempotency-Key")
+			if key == "" || db == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+			switch r.Method {
+			case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+			default:
+				next.ServeHTTP(w, r)
+				return
+			}
+			if len(key) > maxIdempotencyKeyLen {
+				httpError(w, "Idempotency-Key too long", http.StatusBadRequest)
+				return
+			}
+
+			uid, ok := userIDFromCtx(r.Context())
+			if !ok {
+				httpError(w, "missing user", http.StatusUnauthorized)
+				return
+			}
+
+			body, err := io.ReadAll(io.LimitReader(r.Body, maxIdempotentBody+1))
+			if err != nil {
+				httpError(w, "read body failed", http.StatusBadRequest)
+				return
+			}
+			if len(body) > maxIdempotentBody {
+				httpError(w, "request body too large", http.StatusRequestEntityTooLarge)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			hash := requestHash(r, body)
+
+			ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+			claimed, err := claimIdempotencyKey(ctx, db, uid, key, r, hash)
+			if err != nil {
+				cancel()
+				internalError(w, "idempotency check failed", err)
+				return
+			}
+			if !claimed {
+				defer cancel()
+				replayIdempotent(ctx, w, db, uid, key, hash)
+				return
+			}
+			cancel()
+
+			cw := &captureWriter{ResponseWriter: w}
+			next.ServeHTTP(cw, r)
+
+			// Store with a fresh context: the request's may already be done.
+			sctx, scancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer scancel()
+			storeIdempotent(sctx, db, uid, key, cw)
+		})
+	}
+}
+
+// claimIdempotencyKey inserts the in-flight marker. It returns false when
+// a live entry already exists for (uid, key).
+func claimIdempotencyKey(ctx context.Context, db *pgxpool.Pool, uid uuid.UUID, key string, r *http.Request, hash string) (bool, error) {
+	// Drop this user's expired entries, and this key if it was abandoned
+	// in flight.
+	_, err := db.Exec(ctx, `
+		delete from public.idempotency_keys
+		where user_id = $1
+		  and (created_at < now() - $3 * interval '1 second'
+		    or (key = $2 and status_code is null
+		        and created_at < now() - $4 * interval '1 second'))
+	`, uid, key, int(idempotencyTTL.Seconds()), int(idempotencyInFlightTTL.Seconds()))
+	if err != nil {
+		return false, err
+	}
+
+	tag, err := db.Exec(ctx, `
+		insert into public.idempotency_keys (user_id, key, method, path, request_hash)
+		values ($1, $2, $3, $4, $5)
+		on conflict (user_id, key) do nothing
+	`, uid, key, r.Method, r.URL.Path, hash)
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() == 1, nil
+}
+
+func replayIdempotent(ctx context.Context, w http.ResponseWriter, db *pgxpool.Pool, uid uuid.UUID, key, hash string) {
+	var storedHash string
+	var status *int
+	var headersRaw, body []byte
+	err := db.QueryRow(ctx, `
+		select request_hash, status_code, response_headers, response_body
+		from public.idempotency_keys
+		where user_id = $1 and key = $2
+	`, uid, key).Scan(&storedHash, &status, &headersRaw, &body)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			// Raced with a cleanup of an unstored response; let the client retry.
+			httpError(w, "request with this Idempotency-Key is still in progress", http.StatusConflict)
+			return
+		}
+		internalError(w, "idempotency check failed", err)
+		return
+	}
+
+	if storedHash != hash {
+		httpError(w, "Idempotency-Key was already used for a different request", http.StatusUnprocessableEntity)
+		return
+	}
+	if status == nil {
+		w.Header().Set("Retry-After", "1")
+		httpError(w, "request with this Idempotency-Key is still in progress", http.StatusConflict)
+		return
+	}
+
+	var headers map[string]string
+	_ = json.Unmarshal(headersRaw, &headers)
+	for k, v := range headers {
+		w.Header().Set(k, v)
+	}
+	w.Header().Set("Idempotent-Replayed", "true")
+	w.WriteHeader(*status)
+	_, _ = w.Write(body)
+}
+
+// replayableStatus reports whether a response is safe to replay for the
+// key's lifetime. A stale If-Match, a conflict or a quota can be cleared
+// by the client, so replaying them would keep failing a good retry.
+func replayableStatus(status int) bool {
+	if status >= 200 && status < 300 {
+		return true
+	}
+	switch status {
+	case http.StatusBadRequest, http.StatusNotFound,
+		http.StatusRequestEntityTooLarge, http.StatusUnprocessableEntity:
+		return true
+	}
+	return false
+}
+
+func storeIdempotent(ctx context.Context, db *pgxpool.Pool, uid uuid.UUID, key string, cw *captureWriter) {
+	status := cw.status
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	if !replayableStatus(status) {
+		_, err := db.Exec(ctx, `
+			delete from public.idempotency_keys where user_id = $1 and key = $2
+		`, uid, key)
+		if err != nil {
+			log.Printf("idempotency cleanup failed: %v", err)
+		}
+		return
+	}
+
+	headers := map[string]string{}
+	for _, h := range replayHeaders {
+		if v := cw.Header().Get(h); v != "" {
+			headers[h] = v
+		}
+	}
+	headersJSON, _ := json.Marshal(headers)
+
+	_, err := db.Exec(ctx, `
+		update public.idempotency_keys
+		set status_code = $3, response_headers = $4, response_body = $5
+		where user_id = $1 and key = $2
+	`, uid, key, status, headersJSON, cw.body.Bytes())
+	if err != nil {
+		log.Printf("idempotency store failed: %v", err)
+	}
+}
@@ -0,0 +1,106 @@
+package httpapi
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestReplayableStatus(t *testing.T) {
+	cases := map[int]bool{
+		200: true, 201: true, 204: true,
+		400: true, 404: true, 413: true, 422: true,
+		409: false, 412: false, 429: false,
+		500: false, 502: false,
+	}
+	for status, want := range cases {
+		if got := replayableStatus(status); got != want {
+			t.Errorf("replayableStatus(%d) = %v, want %v", status, got, want)
+		}
+	}
+}
+
+func TestIdempotency(t *testing.T) {
+	db := testDB(t)
+	uid := uuid.New()
+	t.Cleanup(func() {
+		_, _ = db.Exec(context.Background(), `delete from public.idempotency_keys where user_id = $1`, uid)
+	})
+
+	var calls atomic.Int32
+	status := http.StatusCreated
+	release := make(chan struct{})
+	blocking := make(chan struct{})
+	h := idempotency(db)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if r.URL.Path == "/slow" {
+			close(blocking)
+			<-release
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(`{"n":1}`))
+	}))
+
+	do := func(path, key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Idempotency-Key", key)
+		req = req.WithContext(context.WithValue(req.Context(), userIDKey, uid))
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("replay", func(t *testing.T) {
+		calls.Store(0)
+		first := do("/plans", "k-replay", `{"a":1}`)
+		second := do("/plans", "k-replay", `{"a":1}`)
+		if calls.Load() != 1 {
+			t.Fatalf("handler ran %d times, want 1", calls.Load())
+		}
+		if second.Code != first.Code || second.Body.String() != first.Body.String() {
+			t.Errorf("replay = %d %q, want %d %q", second.Code, second.Body, first.Code, first.Body)
+		}
+		if second.Header().Get("Idempotent-Replayed") != "true" {
+			t.Error("replay not marked Idempotent-Replayed")
+		}
+	})
+
+	t.Run("different body", func(t *testing.T) {
+		do("/plans", "k-hash", `{"a":1}`)
+		if rec := do("/plans", "k-hash", `{"a":2}`); rec.Code != http.StatusUnprocessableEntity {
+			t.Errorf("reused key = %d, want 422", rec.Code)
+		}
+	})
+
+	t.Run("in flight", func(t *testing.T) {
+		done := make(chan struct{})
+		go func() {
+			do("/slow", "k-flight", `{}`)
+			close(done)
+		}()
+		<-blocking
+		rec := do("/slow", "k-flight", `{}`)
+		close(release)
+		<-done
+		if rec.Code != http.StatusConflict {
+			t.Errorf("retry in flight = %d, want 409", rec.Code)
+		}
+	})
+
+	t.Run("precondition failure is not stored", func(t *testing.T) {
+		calls.Store(0)
+		status = http.StatusPreconditionFailed
+		do("/plans", "k-412", `{}`)
+		status = http.StatusOK
+		rec := do("/plans", "k-412", `{}`)
+		if calls.Load() != 2 || rec.Code != http.StatusOK {
+			t.Errorf("retry after 412: %d calls, status %d; want 2 calls, 200", calls.Load(), rec.Code)
+		}
+	})
+}
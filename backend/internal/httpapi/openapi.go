@@ -0,0 +1,197 @@
+package httpapi
+
+import (
+	"bytes"
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/legacy"
+)
+
+// openapi.yaml is the contract for every route in NewRouter. It is kept
+// by hand; TestOpenAPIMatchesRouter and TestOpenAPIMatchesGoTypes fail
+// when it drifts from the router or from the request/response structs.
+// It lists only the /v1 paths; the deprecated aliases are added on load.
+//
+//go:embed openapi.yaml
+var openapiYAML []byte
+
+var (
+	openapiOnce   sync.Once
+	openapiDoc    *openapi3.T
+	openapiJSON   []byte
+	openapiRouter routers.Router
+	openapiErr    error
+)
+
+func loadOpenAPI() (*openapi3.T, error) {
+	openapiOnce.Do(func() {
+		loader := openapi3.NewLoader()
+		doc, err := loader.LoadFromData(openapiYAML)
+		if err != nil {
+			openapiErr = err
+			return
+		}
+		addLegacyAliases(doc)
+		if err := doc.Validate(context.Background()); err != nil {
+			openapiErr = err
+			return
+		}
+		if openapiJSON, err = json.Marshal(doc); err != nil {
+			openapiErr = err
+			return
+		}
+		if openapiRouter, err = legacy.NewRouter(doc); err != nil {
+			openapiErr = err
+			return
+		}
+		openapiDoc = doc
+	})
+	return openapiDoc, openapiErr
+}
+
+// addLegacyAliases documents the unversioned alias of every /v1 path as
+// a deprecated copy of it.
+func addLegacyAliases(doc *openapi3.T) {
+	for path, item := range doc.Paths.Map() {
+		legacy := legacyPath(path)
+		if legacy == "" {
+			continue
+		}
+		alias := *item
+		for method, op := range item.Operations() {
+			dep := *op
+			dep.Deprecated = true
+			dep.OperationID = op.OperationID + "Legacy"
+			alias.SetOperation(method, &dep)
+		}
+		doc.Paths.Set(legacy, &alias)
+	}
+}
+
+// handleOpenAPI: GET /openapi.json
+func handleOpenAPI() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		_, _ = w.Write(openapiJSON)
+	}
+}
+
+// maxRequestBody caps what validateRequest reads. The largest legitimate
+// body is a full sync push (200 mutations of up to 10 steps each).
+const maxRequestBody = 4 << 20
+
+// validateRequest checks path and query parameters and JSON bodies
+// against the spec before the handler runs. Routes the spec doesn't know
+// fall through to the router's own 404/405. It goes after requireUserID
+// and the rate limits, so only clients let through get their bodies read.
+func validateRequest(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route, pathParams, err := openapiRouter.FindRoute(r)
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if r.Body != nil && r.Body != http.NoBody {
+			body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestBody))
+			if err != nil {
+				var tooBig *http.MaxBytesError
+				if errors.As(err, &tooBig) {
+					httpError(w, "request body too large", http.StatusRequestEntityTooLarge)
+					return
+				}
+				httpError(w, "invalid body", http.StatusBadRequest)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+		}
+
+		// Handlers decode bodies as JSON whatever the header says.
+		if r.ContentLength != 0 && r.Header.Get("Content-Type") == "" {
+			r.Header.Set("Content-Type", "application/json")
+		}
+
+		input := &openapi3filter.RequestValidationInput{
+			Request:    r,
+			PathParams: pathParams,
+			Route:      route,
+			Options: &openapi3filter.Options{
+				MultiError:          true,
+				SkipSettingDefaults: true,
+				AuthenticationFunc:  openapi3filter.NoopAuthenticationFunc,
+			},
+		}
+		if err := openapi3filter.ValidateRequest(r.Context(), input); err != nil {
+			writeAPIError(w, http.StatusBadRequest, APIError{
+				Code:    "invalid_request",
+				Message: "request does not match the API schema",
+				Details: requestErrorDetails(err),
+			})
+			return
+		}
+		// ValidateRequest puts the body it read back on r.
+		next.ServeHTTP(w, r)
+	})
+}
+
+// requestErrorDetails flattens a validation error into one FieldError per
+// problem. Field is "body.<json path>", "query.<name>", "path.<name>" or
+// "header.<name>".
+func requestErrorDetails(err error) []FieldError {
+	var out []FieldError
+	var walk func(error)
+	walk = func(err error) {
+		// Type switches, not errors.As: RequestError unwraps to the
+		// MultiError inside it, and we want the outer one first.
+		switch e := err.(type) {
+		case openapi3.MultiError:
+			for _, inner := range e {
+				walk(inner)
+			}
+		case *openapi3filter.RequestError:
+			field := "body"
+			if e.Parameter != nil {
+				field = e.Parameter.In + "." + e.Parameter.Name
+			}
+			switch inner := e.Err.(type) {
+			case nil:
+				out = append(out, FieldError{Field: field, Message: e.Reason})
+			case openapi3.MultiError:
+				for _, ie := range inner {
+					out = append(out, schemaFieldError(field, e.Reason, ie))
+				}
+			default:
+				out = append(out, schemaFieldError(field, e.Reason, inner))
+			}
+		default:
+			out = append(out, FieldError{Field: "request", Message: err.Error()})
+		}
+	}
+	walk(err)
+	return out
+}
+
+func schemaFieldError(field, reason string, err error) FieldError {
+	var schemaErr *openapi3.SchemaError
+	if !errors.As(err, &schemaErr) {
+		if reason == "" {
+			reason = err.Error()
+		}
+		return FieldError{Field: field, Message: reason}
+	}
+	if ptr := schemaErr.JSONPointer(); len(ptr) > 0 {
+		field += "." + strings.Join(ptr, ".")
+	}
+	return FieldError{Field: field, Message: schemaErr.Reason}
+}
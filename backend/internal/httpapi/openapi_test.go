@@ -0,0 +1,374 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/go-chi/chi/v5"
+
+	"sliceapp-backend/internal/config"
+)
+
+// specTypes maps component schemas to the Go structs they describe.
+// For request types a pointer field may still be required (the pointer
+// only tells "missing" from zero); omitempty ones may not.
+var specTypes = map[string]struct {
+	v       any
+	request bool
+}{
+	"APIError":                {APIError{}, false},
+	"FieldError":              {FieldError{}, false},
+	"AnonymousUser":           {anonResp{}, false},
+	"PlanDayStep":             {PlanDayStep{}, false},
+	"PlanDayStepInput":        {PlanDayStep{}, true},
+	"PlanDay":                 {PlanDay{}, false},
+	"PlanDetailResponse":      {PlanDetailResponse{}, false},
+	"PlanListItem":            {PlanListItem{}, false},
+	"TagRef":                  {TagRef{}, false},
+	"CreatePlanRequest":       {CreatePlanRequest{}, true},
+	"SplitterMeta":            {SplitterMeta{}, false},
+	"CreatedPlan":             {CreatedPlan{}, false},
+	"CreatePlanResponse":      {CreatePlanResponse{}, false},
+	"UpdatePlanRequest":       {UpdatePlanRequest{}, true},
+	"UpdatePlanDayRequest":    {UpdatePlanDayRequest{}, true},
+	"DayUpdateResult":         {DayUpdateResult{}, false},
+	"InsertDayRequest":        {InsertDayRequest{}, true},
+	"DayOperation":            {DayOperation{}, true},
+	"BatchDaysRequest":        {BatchDaysRequest{}, true},
+	"DayOperationResult":      {DayOperationResult{}, false},
+	"BatchDaysResponse":       {BatchDaysResponse{}, false},
+	"MoveDayRequest":          {MoveDayRequest{}, true},
+	"SetPlanStatusRequest":    {SetPlanStatusRequest{}, true},
+	"PlanProgress":            {PlanProgress{}, false},
+	"TrashItem":               {TrashItem{}, false},
+	"Tag":                     {Tag{}, false},
+	"TagRequest":              {TagRequest{}, true},
+	"TagStats":                {TagStats{}, false},
+	"CreateShareRequest":      {CreateShareRequest{}, true},
+	"ShareResponse":           {ShareResponse{}, false},
+	"PlanMember":              {PlanMember{}, false},
+	"StepClaim":               {StepClaim{}, false},
+	"PlanTeamResponse":        {PlanTeamResponse{}, false},
+	"AddMemberRequest":        {AddMemberRequest{}, true},
+	"UpdateMemberRequest":     {UpdateMemberRequest{}, true},
+	"MemberCompletionRequest": {MemberCompletionRequest{}, true},
+	"PlanRevision":            {PlanRevision{}, false},
+	"RevertRequest":           {RevertRequest{}, true},
+	"DuplicatePlanRequest":    {DuplicatePlanRequest{}, true},
+	"SaveTemplateRequest":     {SaveTemplateRequest{}, true},
+	"PlanFromTemplateRequest": {PlanFromTemplateRequest{}, true},
+	"TemplateStep":            {TemplateStep{}, false},
+	"TemplateDay":             {TemplateDay{}, false},
+	"PlanTemplate":            {PlanTemplate{}, false},
+	"SyncPlan":                {SyncPlan{}, false},
+	"SyncDay":                 {SyncDay{}, false},
+	"SyncCompletion":          {SyncCompletion{}, false},
+	"SyncDeletion":            {SyncDeletion{}, false},
+	"SyncMutation":            {SyncMutation{}, true},
+	"SyncResult":              {SyncResult{}, false},
+	"SyncPushRequest":         {SyncPushRequest{}, true},
+	"SyncResponse":            {SyncResponse{}, false},
+	"PartnerInvite":           {PartnerInvite{}, false},
+	"Partner":                 {Partner{}, false},
+	"PartnerDay":              {PartnerDay{}, false},
+	"PartnerProgress":         {PartnerProgress{}, false},
+	"PartnerEvent":            {PartnerEvent{}, false},
+	"CreateInviteRequest":     {CreateInviteRequest{}, true},
+	"SendNudgeRequest":        {SendNudgeRequest{}, true},
+	"MarkFeedSeenRequest":     {MarkFeedSeenRequest{}, true},
+	"UsageRow":                {UsageRow{}, false},
+	"UsageReport":             {UsageReport{}, false},
+}
+
+func mustLoadOpenAPI(t *testing.T) *openapi3.T {
+	t.Helper()
+	doc, err := loadOpenAPI()
+	if err != nil {
+		t.Fatalf("load openapi.yaml: %v", err)
+	}
+	return doc
+}
+
+var pathParam = regexp.MustCompile(`\{[^}]+\}`)
+
+// normalizePath drops param names: chi and the spec may name them
+// differently.
+func normalizePath(p string) string {
+	return pathParam.ReplaceAllString(p, "{}")
+}
+
+func TestOpenAPIMatchesRouter(t *testing.T) {
+	doc := mustLoadOpenAPI(t)
+
+	inSpec := map[string]bool{}
+	for path, item := range doc.Paths.Map() {
+		for method := range item.Operations() {
+			inSpec[method+" "+normalizePath(path)] = true
+		}
+	}
+
+	inRouter := map[string]bool{}
+	h := NewRouter(nil, config.Config{}, nil).(chi.Routes)
+	err := chi.Walk(h, func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		inRouter[method+" "+normalizePath(route)] = true
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for op := range inRouter {
+		if !inSpec[op] {
+			t.Errorf("route %s is not in openapi.yaml", op)
+		}
+	}
+	for op := range inSpec {
+		if !inRouter[op] {
+			t.Errorf("openapi.yaml has %s but the router doesn't", op)
+		}
+	}
+}
+
+func TestOpenAPIMatchesGoTypes(t *testing.T) {
+	doc := mustLoadOpenAPI(t)
+
+	for name, st := range specTypes {
+		ref := doc.Components.Schemas[name]
+		if ref == nil {
+			t.Errorf("%s: no such schema", name)
+			continue
+		}
+		checkSchema(t, name, reflect.TypeOf(st.v), ref.Value, st.request)
+	}
+}
+
+type jsonField struct {
+	name      string
+	omitempty bool
+	typ       reflect.Type
+}
+
+// jsonFields lists the JSON properties encoding/json would produce for t,
+// including promoted fields of embedded structs.
+func jsonFields(t reflect.Type) []jsonField {
+	var out []jsonField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if f.Anonymous && tag == "" {
+			out = append(out, jsonFields(f.Type)...)
+			continue
+		}
+		if !f.IsExported() || tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = f.Name
+		}
+		out = append(out, jsonField{name: name, omitempty: strings.Contains(opts, "omitempty"), typ: f.Type})
+	}
+	return out
+}
+
+func checkSchema(t *testing.T, name string, typ reflect.Type, schema *openapi3.Schema, request bool) {
+	t.Helper()
+
+	required := map[string]bool{}
+	for _, r := range schema.Required {
+		required[r] = true
+	}
+
+	fields := map[string]bool{}
+	for _, f := range jsonFields(typ) {
+		fields[f.name] = true
+		where := name + "." + f.name
+
+		prop := schema.Properties[f.name]
+		if prop == nil {
+			t.Errorf("%s: field missing from the spec", where)
+			continue
+		}
+		checkType(t, where, f.typ, prop.Value)
+
+		switch {
+		case request && f.omitempty && required[f.name]:
+			t.Errorf("%s: optional in Go but required in the spec", where)
+		case !request && !f.omitempty && !required[f.name]:
+			t.Errorf("%s: always sent but not required in the spec", where)
+		case !request && f.omitempty && required[f.name]:
+			t.Errorf("%s: omitempty in Go but required in the spec", where)
+		case !request && !f.omitempty && f.typ.Kind() == reflect.Pointer && !prop.Value.Nullable:
+			t.Errorf("%s: can be null but the spec doesn't say nullable", where)
+		}
+	}
+
+	for p := range schema.Properties {
+		if !fields[p] {
+			t.Errorf("%s.%s: in the spec but not in the Go type", name, p)
+		}
+	}
+}
+
+var (
+	timeType = reflect.TypeOf(time.Time{})
+	rawType  = reflect.TypeOf(json.RawMessage{})
+)
+
+// checkType compares a Go type with a property schema's type, one array
+// level deep. Nested objects are covered by their own component.
+func checkType(t *testing.T, where string, typ reflect.Type, schema *openapi3.Schema) {
+	t.Helper()
+	for typ.Kind() == reflect.Pointer {
+		typ = typ.Elem()
+	}
+	if typ == rawType || schema.Type == nil || len(schema.Type.Slice()) == 0 {
+		return
+	}
+
+	want := ""
+	switch {
+	case typ == timeType:
+		want = "string"
+	default:
+		switch typ.Kind() {
+		case reflect.String:
+			want = "string"
+		case reflect.Bool:
+			want = "boolean"
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			want = "integer"
+		case reflect.Float32, reflect.Float64:
+			want = "number"
+		case reflect.Slice, reflect.Array:
+			want = "array"
+		case reflect.Map, reflect.Struct:
+			want = "object"
+		}
+	}
+	if !schema.Type.Is(want) {
+		t.Errorf("%s: Go type %s is %q in JSON but the spec says %v", where, typ, want, schema.Type.Slice())
+		return
+	}
+	if want == "array" && schema.Items != nil {
+		checkType(t, where+"[]", typ.Elem(), schema.Items.Value)
+	}
+}
+
+// The spec repeats validateSteps' limits; TestOpenAPIMatchesGoTypes only
+// sees names and types, so check the numbers here.
+func TestOpenAPIStepLimits(t *testing.T) {
+	doc := mustLoadOpenAPI(t)
+
+	step := doc.Components.Schemas["PlanDayStepInput"].Value
+	maxLen := map[string]int{
+		"title":           maxStepTitleLen,
+		"deliverable":     maxStepDetailLen,
+		"done_definition": maxStepDetailLen,
+	}
+	for name, want := range maxLen {
+		p := step.Properties[name].Value
+		if p.MaxLength == nil || int(*p.MaxLength) != want {
+			t.Errorf("PlanDayStepInput.%s maxLength = %v, want %d", name, p.MaxLength, want)
+		}
+	}
+	minutes := step.Properties["minutes"].Value
+	if minutes.Min == nil || *minutes.Min != minStepMinutes || minutes.Max == nil || *minutes.Max != maxStepMinutes {
+		t.Errorf("PlanDayStepInput.minutes range = %v..%v, want %d..%d", minutes.Min, minutes.Max, minStepMinutes, maxStepMinutes)
+	}
+
+	for _, name := range []string{"UpdatePlanDayRequest", "DayOperation", "InsertDayRequest"} {
+		steps := doc.Components.Schemas[name].Value.Properties["steps"].Value
+		if steps.MaxItems == nil || int(*steps.MaxItems) != maxStepsPerDay {
+			t.Errorf("%s.steps maxItems = %v, want %d", name, steps.MaxItems, maxStepsPerDay)
+		}
+	}
+}
+
+func TestValidateRequest(t *testing.T) {
+	h := NewRouter(nil, config.Config{}, nil)
+	const user = "8d3c2f1e-5b7a-4c9d-8e6f-0a1b2c3d4e5f"
+	const plan = "0f1e2d3c-4b5a-4968-8776-655443322110"
+
+	cases := []struct {
+		name, method, path, body string
+		want                     int
+		wantField                string
+	}{
+		{"bad day status", "PATCH", "/plans/" + plan + "/days/1", `{"status":"maybe"}`, http.StatusBadRequest, "body.status"},
+		{"step minutes out of range", "PATCH", "/plans/" + plan + "/days/1", `{"steps":[{"title":"a","minutes":0,"done_definition":"b"}]}`, http.StatusBadRequest, "body.steps.0.minutes"},
+		{"plan id not a uuid", "GET", "/plans/nope", "", http.StatusBadRequest, "path.id"},
+		{"limit not a number", "GET", "/plans?limit=ten", "", http.StatusBadRequest, "query.limit"},
+		{"missing required field", "POST", "/plans/" + plan + "/days/2/move", `{}`, http.StatusBadRequest, "body.to"},
+		{"unknown batch op", "POST", "/v1/plans/" + plan + "/days:batch", `{"operations":[{"op":"delete","day":1}]}`, http.StatusBadRequest, "body.operations.0.op"},
+		{"empty batch", "POST", "/v1/plans/" + plan + "/days:batch", `{"operations":[]}`, http.StatusBadRequest, "body.operations"},
+		{"body too large", "PATCH", "/plans/" + plan + "/days/1", `{"focus":"` + strings.Repeat("a", maxRequestBody) + `"}`, http.StatusRequestEntityTooLarge, ""},
+		// Valid requests reach the handler, which has no database here.
+		{"valid day patch", "PATCH", "/plans/" + plan + "/days/1", `{"status":"bad_day"}`, http.StatusServiceUnavailable, ""},
+		{"valid batch", "POST", "/v1/plans/" + plan + "/days:batch", `{"operations":[{"op":"set_done","day":1,"is_done":true},{"op":"clear","day":2}]}`, http.StatusServiceUnavailable, ""},
+		{"valid list", "GET", "/plans?status=all&limit=5", "", http.StatusServiceUnavailable, ""},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var body *strings.Reader
+			if c.body != "" {
+				body = strings.NewReader(c.body)
+			} else {
+				body = strings.NewReader("")
+			}
+			req := httptest.NewRequest(c.method, c.path, body)
+			req.Header.Set("X-User-Id", user)
+			if c.body != "" {
+				req.Header.Set("Content-Type", "application/json")
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != c.want {
+				t.Fatalf("status = %d, want %d; body %s", rec.Code, c.want, rec.Body)
+			}
+			if c.wantField == "" {
+				return
+			}
+			var resp struct {
+				Error APIError `json:"error"`
+			}
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("decode: %v", err)
+			}
+			if resp.Error.Code != "invalid_request" {
+				t.Errorf("code = %q", resp.Error.Code)
+			}
+			found := false
+			for _, d := range resp.Error.Details {
+				found = found || d.Field == c.wantField
+			}
+			if !found {
+				t.Errorf("no detail for %s: %+v", c.wantField, resp.Error.Details)
+			}
+		})
+	}
+}
+
+func TestOpenAPIServed(t *testing.T) {
+	h := NewRouter(nil, config.Config{}, nil)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/openapi.json", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d", rec.Code)
+	}
+	var doc map[string]any
+	if err := json.Unmarshal(rec.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("not json: %v", err)
+	}
+	if doc["openapi"] != "3.0.3" {
+		t.Errorf("openapi = %v", doc["openapi"])
+	}
+}
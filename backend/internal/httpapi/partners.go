@@ -0,0 +1,606 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const maxNudgeMessageLen = 140
+
+type PartnerInvite struct {
+	ID          string     `json:"id"`
+	InviterID   string     `json:"inviter_id"`
+	InviteeID   string     `json:"invitee_id"`
+	Status      string     `json:"status"`
+	CreatedAt   time.Time  `json:"created_at"`
+	RespondedAt *time.Time `json:"responded_at"`
+}
+
+type Partner struct {
+	UserID string    `json:"user_id"`
+	Since  time.Time `json:"since"`
+}
+
+type PartnerDay struct {
+	DayNumber int  `json:"day_number"`
+	IsDone    bool `json:"is_done"`
+}
+
+// PartnerProgress is what a partner may see: completion only, no step content.
+type PartnerProgress struct {
+	UserID       string       `json:"user_id"`
+	PlanID       string       `json:"plan_id"`
+	Title        string       `json:"title"`
+	Days         int          `json:"days"`
+	DailyMinutes int          `json:"daily_minutes"`
+	CreatedAt    time.Time    `json:"created_at"`
+	DaysDone     int          `json:"days_done"`
+	Items        []PartnerDay `json:"items"`
+}
+
+type PartnerEvent struct {
+	ID        int64     `json:"id"`
+	ActorID   string    `json:"actor_id"`
+	Kind      string    `json:"kind"`
+	Message   string    `json:"message"`
+	PlanID    *string   `json:"plan_id"`
+	DayNumber *int      `json:"day_number"`
+	CreatedAt time.Time `json:"created_at"`
+	Seen      bool      `json:"seen"`
+}
+
+type CreateInviteRequest struct {
+	PartnerID string `json:"partner_id"`
+}
+
+type SendNudgeRequest struct {
+	Kind    string `json:"kind"` // nudge | cheer
+	Message string `json:"message"`
+}
+
+type MarkFeedSeenRequest struct {
+	UpToID int64 `json:"up_to_id"`
+}
+
+// isPartner reports whether a and b have an accepted partnership.
+// This sits next to the plain user_id ownership checks: owners see
+// everything, partners only see progress and may send nudges.
+func isPartner(ctx context.Context, q querier, a, b uuid.UUID) (bool, error) {
+	var ok bool
+	err := q.QueryRow(ctx, `
+		select exists (
+			select 1 from public.partner_invites
+			where status = 'accepted'
+			  and ((inviter_id = $1 and invitee_id = $2)
+			    or (inviter_id = $2 and invitee_id = $1))
+		)
+	`, a, b).Scan(&ok)
+	return ok, err
+}
+
+// recordDayDoneEvent fans a day_done event out to every partner of uid,
+// once per day: writing a day as done again adds nothing to the feed.
+// Best effort: a failure here must not fail the day update itself.
+func recordDayDoneEvent(ctx context.Context, q querier, uid uuid.UUID, planID string, dayNumber int) {
+	_, err := q.Exec(ctx, `
+		insert into public.partner_events (actor_id, target_id, plan_id, day_number, kind)
+		select $1,
+		       case when i.inviter_id = $1 then i.invitee_id else i.inviter_id end,
+		       $2, $3, 'day_done'
+		from public.partner_invites i
+		where i.status = 'accepted' and (i.inviter_id = $1 or i.invitee_id = $1)
+		on conflict do nothing
+	`, uid, planID, dayNumber)
+	if err != nil {
+		log.Printf("record day_done event failed: %v", err)
+	}
+}
+
+func handleCreatePartnerInvite(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if db == nil {
+			httpError(w, "db not connected", http.StatusServiceUnavailable)
+			return
+		}
+		uid, ok := userIDFromCtx(r.Context())
+		if !ok {
+			httpError(w, "missing user", http.StatusUnauthorized)
+			return
+		}
+
+		var req CreateInviteRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			httpError(w, "invalid json body", http.StatusBadRequest)
+			return
+		}
+		partnerID, err := uuid.Parse(req.PartnerID)
+		if err != nil {
+			httpError(w, "invalid partner_id", http.StatusBadRequest)
+			return
+		}
+		if partnerID == uid {
+			httpError(w, "cannot invite yourself", http.StatusBadRequest)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 8*time.Second)
+		defer cancel()
+
+		var inv PartnerInvite
+		err = db.QueryRow(ctx, `
+			insert into public.partner_invites (inviter_id, invitee_id)
+			select $1, u.id from public.users u where u.id = $2
+			returning id, inviter_id, invitee_id, status, created_at, responded_at
+		`, uid, partnerID).Scan(&inv.ID, &inv.InviterID, &inv.InviteeID, &inv.Status, &inv.CreatedAt, &inv.RespondedAt)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				httpError(w, "user not found", http.StatusNotFound)
+				return
+			}
+			if isUniqueViolation(err) {
+				httpError(w, "invite already exists", http.StatusConflict)
+				return
+			}
+			internalError(w, "create invite failed", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(inv)
+	}
+}
+
+func handleListPartnerInvites(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if db == nil {
+			httpError(w, "db not connected", http.StatusServiceUnavailable)
+			return
+		}
+		uid, ok := userIDFromCtx(r.Context())
+		if !ok {
+			httpError(w, "missing user", http.StatusUnauthorized)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 8*time.Second)
+		defer cancel()
+
+		rows, err := db.Query(ctx, `
+			select id, inviter_id, invitee_id, status, created_at, responded_at
+			from public.partner_invites
+			where status = 'pending' and (inviter_id = $1 or invitee_id = $1)
+			order by created_at desc
+			limit 100
+		`, uid)
+		if err != nil {
+			internalError(w, "query failed", err)
+			return
+		}
+		defer rows.Close()
+
+		incoming := make([]PartnerInvite, 0)
+		outgoing := make([]PartnerInvite, 0)
+		for rows.Next() {
+			var inv PartnerInvite
+			if err := rows.Scan(&inv.ID, &inv.InviterID, &inv.InviteeID, &inv.Status, &inv.CreatedAt, &inv.RespondedAt); err != nil {
+				internalError(w, "scan failed", err)
+				return
+			}
+			if inv.InviteeID == uid.String() {
+				incoming = append(incoming, inv)
+			} else {
+				outgoing = append(outgoing, inv)
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"incoming": incoming,
+			"outgoing": outgoing,
+		})
+	}
+}
+
+// handleRespondPartnerInvite accepts or declines a pending invite.
+// Only the invitee can respond.
+func handleRespondPartnerInvite(db *pgxpool.Pool, status string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if db == nil {
+			httpError(w, "db not connected", http.StatusServiceUnavailable)
+			return
+		}
+		uid, ok := userIDFromCtx(r.Context())
+		if !ok {
+			httpError(w, "missing user", http.StatusUnauthorized)
+			return
+		}
+
+		inviteID, err := uuid.Parse(chi.URLParam(r, "inviteId"))
+		if err != nil {
+			httpError(w, "invalid invite id", http.StatusBadRequest)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 8*time.Second)
+		defer cancel()
+
+		var inv PartnerInvite
+		err = db.QueryRow(ctx, `
+			update public.partner_invites
+			set status = $1, responded_at = now()
+			where id = $2 and invitee_id = $3 and status = 'pending'
+			returning id, inviter_id, invitee_id, status, created_at, responded_at
+		`, status, inviteID, uid).Scan(&inv.ID, &inv.InviterID, &inv.InviteeID, &inv.Status, &inv.CreatedAt, &inv.RespondedAt)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				httpError(w, "invite not found", http.StatusNotFound)
+				return
+			}
+			internalError(w, "update invite failed", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(inv)
+	}
+}
+
+func handleListPartners(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if db == nil {
+			httpError(w, "db not connected", http.StatusServiceUnavailable)
+			return
+		}
+		uid, ok := userIDFromCtx(r.Context())
+		if !ok {
+			httpError(w, "missing user", http.StatusUnauthorized)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 8*time.Second)
+		defer cancel()
+
+		rows, err := db.Query(ctx, `
+			select case when inviter_id = $1 then invitee_id else inviter_id end,
+			       coalesce(responded_at, created_at)
+			from public.partner_invites
+			where status = 'accepted' and (inviter_id = $1 or invitee_id = $1)
+			order by 2 desc
+		`, uid)
+		if err != nil {
+			internalError(w, "query failed", err)
+			return
+		}
+		defer rows.Close()
+
+		out := make([]Partner, 0)
+		for rows.Next() {
+			var p Partner
+			if err := rows.Scan(&p.UserID, &p.Since); err != nil {
+				internalError(w, "scan failed", err)
+				return
+			}
+			out = append(out, p)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{"partners": out})
+	}
+}
+
+// handleRemovePartner ends an accepted partnership from either side.
+func handleRemovePartner(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if db == nil {
+			httpError(w, "db not connected", http.StatusServiceUnavailable)
+			return
+		}
+		uid, ok := userIDFromCtx(r.Context())
+		if !ok {
+			httpError(w, "missing user", http.StatusUnauthorized)
+			return
+		}
+
+		partnerID, err := uuid.Parse(chi.URLParam(r, "userId"))
+		if err != nil {
+			httpError(w, "invalid user id", http.StatusBadRequest)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 8*time.Second)
+		defer cancel()
+
+		tag, err := db.Exec(ctx, `
+			delete from public.partner_invites
+			where status = 'accepted'
+			  and ((inviter_id = $1 and invitee_id = $2)
+			    or (inviter_id = $2 and invitee_id = $1))
+		`, uid, partnerID)
+		if err != nil {
+			internalError(w, "delete failed", err)
+			return
+		}
+		if tag.RowsAffected() == 0 {
+			httpError(w, "partner not found", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"ok":      true,
+			"user_id": partnerID.String(),
+		})
+	}
+}
+
+// handleGetPartnerProgress shows a partner's active plan (the most recent
+// one) as daily completion only.
+func handleGetPartnerProgress(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if db == nil {
+			httpError(w, "db not connected", http.StatusServiceUnavailable)
+			return
+		}
+		uid, ok := userIDFromCtx(r.Context())
+		if !ok {
+			httpError(w, "missing user", http.StatusUnauthorized)
+			return
+		}
+
+		partnerID, err := uuid.Parse(chi.URLParam(r, "userId"))
+		if err != nil {
+			httpError(w, "invalid user id", http.StatusBadRequest)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+
+		allowed, err := isPartner(ctx, db, uid, partnerID)
+		if err != nil {
+			internalError(w, "partner check failed", err)
+			return
+		}
+		if !allowed {
+			httpError(w, "partner not found", http.StatusNotFound)
+			return
+		}
+
+		resp := PartnerProgress{UserID: partnerID.String()}
+		err = db.QueryRow(ctx, `
+			select p.id, p.title, p.days, p.daily_minutes, p.created_at
+			from public.plans p
+			join public.plan_members m on m.plan_id = p.id
+			where m.user_id = $1 and m.role = 'owner'
+			  and p.status = 'active' and p.deleted_at is null
+			order by p.created_at desc
+			limit 1
+		`, partnerID).Scan(&resp.PlanID, &resp.Title, &resp.Days, &resp.DailyMinutes, &resp.CreatedAt)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				httpError(w, "partner has no active plan", http.StatusNotFound)
+				return
+			}
+			internalError(w, "query failed", err)
+			return
+		}
+
+		rows, err := db.Query(ctx, `
+			select day_number, is_done
+			from public.plan_days
+			where plan_id = $1
+			order by day_number asc
+		`, resp.PlanID)
+		if err != nil {
+			internalError(w, "query plan_days failed", err)
+			return
+		}
+		defer rows.Close()
+
+		resp.Items = make([]PartnerDay, 0)
+		for rows.Next() {
+			var d PartnerDay
+			if err := rows.Scan(&d.DayNumber, &d.IsDone); err != nil {
+				internalError(w, "scan failed", err)
+				return
+			}
+			if d.IsDone {
+				resp.DaysDone++
+			}
+			resp.Items = append(resp.Items, d)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(resp)
+	}
+}
+
+// handleSendNudge drops a nudge or cheer into the partner's feed. The app
+// polls the feed (app/src/partnerNotifications.ts), shows unseen entries as
+// local notifications and marks them seen.
+func handleSendNudge(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if db == nil {
+			httpError(w, "db not connected", http.StatusServiceUnavailable)
+			return
+		}
+		uid, ok := userIDFromCtx(r.Context())
+		if !ok {
+			httpError(w, "missing user", http.StatusUnauthorized)
+			return
+		}
+
+		partnerID, err := uuid.Parse(chi.URLParam(r, "userId"))
+		if err != nil {
+			httpError(w, "invalid user id", http.StatusBadRequest)
+			return
+		}
+
+		var req SendNudgeRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			httpError(w, "invalid json body", http.StatusBadRequest)
+			return
+		}
+		if req.Kind == "" {
+			req.Kind = "nudge"
+		}
+		if req.Kind != "nudge" && req.Kind != "cheer" {
+			httpError(w, "kind must be nudge or cheer", http.StatusBadRequest)
+			return
+		}
+		req.Message = strings.TrimSpace(req.Message)
+		if len([]rune(req.Message)) > maxNudgeMessageLen {
+			httpError(w, "message too long", http.StatusBadRequest)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 8*time.Second)
+		defer cancel()
+
+		allowed, err := isPartner(ctx, db, uid, partnerID)
+		if err != nil {
+			internalError(w, "partner check failed", err)
+			return
+		}
+		if !allowed {
+			httpError(w, "partner not found", http.StatusNotFound)
+			return
+		}
+
+		var ev PartnerEvent
+		err = db.QueryRow(ctx, `
+			insert into public.partner_events (actor_id, target_id, kind, message)
+			values ($1, $2, $3, $4)
+			returning id, actor_id, kind, message, plan_id, day_number, created_at
+		`, uid, partnerID, req.Kind, req.Message).Scan(&ev.ID, &ev.ActorID, &ev.Kind, &ev.Message, &ev.PlanID, &ev.DayNumber, &ev.CreatedAt)
+		if err != nil {
+			internalError(w, "send failed", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(ev)
+	}
+}
+
+// handlePartnerFeed lists events addressed to the current user, newest first.
+// ?before=<id> pages backwards, ?limit= caps the page (default 50).
+func handlePartnerFeed(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if db == nil {
+			httpError(w, "db not connected", http.StatusServiceUnavailable)
+			return
+		}
+		uid, ok := userIDFromCtx(r.Context())
+		if !ok {
+			httpError(w, "missing user", http.StatusUnauthorized)
+			return
+		}
+
+		limit := 50
+		if v := r.URL.Query().Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 {
+				httpError(w, "invalid limit", http.StatusBadRequest)
+				return
+			}
+			limit = clampInt(n, 1, 100)
+		}
+		var before *int64
+		if v := r.URL.Query().Get("before"); v != "" {
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				httpError(w, "invalid before", http.StatusBadRequest)
+				return
+			}
+			before = &n
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 8*time.Second)
+		defer cancel()
+
+		rows, err := db.Query(ctx, `
+			select id, actor_id, kind, message, plan_id, day_number, created_at, seen_at is not null
+			from public.partner_events
+			where target_id = $1 and ($2::bigint is null or id < $2)
+			order by id desc
+			limit $3
+		`, uid, before, limit)
+		if err != nil {
+			internalError(w, "query failed", err)
+			return
+		}
+		defer rows.Close()
+
+		out := make([]PartnerEvent, 0)
+		for rows.Next() {
+			var ev PartnerEvent
+			if err := rows.Scan(&ev.ID, &ev.ActorID, &ev.Kind, &ev.Message, &ev.PlanID, &ev.DayNumber, &ev.CreatedAt, &ev.Seen); err != nil {
+				internalError(w, "scan failed", err)
+				return
+			}
+			out = append(out, ev)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{"events": out})
+	}
+}
+
+// handleMarkFeedSeen marks every event up to and including up_to_id as seen,
+// so the app does not notify twice for the same nudge.
+func handleMarkFeedSeen(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if db == nil {
+			httpError(w, "db not connected", http.StatusServiceUnavailable)
+			return
+		}
+		uid, ok := userIDFromCtx(r.Context())
+		if !ok {
+			httpError(w, "missing user", http.StatusUnauthorized)
+			return
+		}
+
+		var req MarkFeedSeenRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			httpError(w, "invalid json body", http.StatusBadRequest)
+			return
+		}
+		if req.UpToID <= 0 {
+			httpError(w, "invalid up_to_id", http.StatusBadRequest)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 8*time.Second)
+		defer cancel()
+
+		tag, err := db.Exec(ctx, `
+			update public.partner_events
+			set seen_at = now()
+			where target_id = $1 and id <= $2 and seen_at is null
+		`, uid, req.UpToID)
+		if err != nil {
+			internalError(w, "update failed", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"ok":     true,
+			"marked": tag.RowsAffected(),
+		})
+	}
+}
@@ -3,14 +3,16 @@ package httpapi
 import (
 	"context"
 	"encoding/json"
-	"math"
 	"net/http"
 	"strconv"
 	"time"
 
 	"sliceapp-backend/internal/ai"
 	"sliceapp-backend/internal/config"
+	"sliceapp-backend/internal/splitcache"
 
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
@@ -43,24 +45,178 @@ type PlanDay struct {
 	Focus     string        `json:"focus"`
 	Steps     []PlanDayStep `json:"steps"`
 	IsDone    bool          `json:"is_done"`
+	Status    string        `json:"status,omitempty"` // pending | done | bad_day | skipped
+}
+
+// SplitterMeta is the splitter's reasoning about the goal, shown to the
+// user right after a plan is created.
+type SplitterMeta struct {
+	SplitterQuote     string   `json:"splitter_quote"`
+	Mode              string   `json:"mode"`
+	GoalType          string   `json:"goal_type"`
+	OriginalGoal      string   `json:"original_goal"`
+	FinalGoal         string   `json:"final_goal"`
+	Changed           bool     `json:"changed"`
+	WhyThisAdjustment string   `json:"why_this_adjustment"`
+	SuccessRule       string   `json:"success_rule"`
+	Assumptions       []string `json:"assumptions"`
+	RiskNotes         []string `json:"risk_notes"`
+	// Cached is true when the splitter's answer came from the cache
+	// rather than a fresh AI call.
+	Cached bool `json:"cached"`
+}
+
+// newSplitterCache is the cache for handleCreatePlan, or nil when it is
+// turned off.
+func newSplitterCache(db *pgxpool.Pool, cfg config.Config) *splitcache.Cache {
+	if !cfg.SplitterCache {
+		return nil
+	}
+	if !cfg.SplitterCachePG {
+		db = nil
+	}
+	return splitcache.New(cfg.SplitterCacheSize, cfg.SplitterCacheTTL, db)
+}
+
+type CreatedPlan struct {
+	ID           string    `json:"id"`
+	Title        string    `json:"title"`
+	Days         int       `json:"days"`
+	DailyMinutes int       `json:"daily_minutes"`
+	CreatedAt    time.Time `json:"created_at,omitempty"`
+	Items        []PlanDay `json:"items"`
 }
 
 type CreatePlanResponse struct {
-	PlanID string    `json:"plan_id"`
-	Title  string    `json:"title"`
-	Days   int       `json:"days"`
-	Items  []PlanDay `json:"items"`
+	Meta SplitterMeta `json:"meta"`
+	Plan CreatedPlan  `json:"plan"`
+}
+
+// newPlan is everything insertPlan needs to write a plan and its days.
+type newPlan struct {
+	Title        string
+	Days         int
+	DailyMinutes int
+	GoalType     string
+	SourcePlanID *string
+	Items        []PlanDay
 }
 
-func handleCreatePlan(db *pgxpool.Pool, cfg config.Config) http.HandlerFunc {
+// insertPlan writes a plan, its owner membership and its days inside tx.
+// Used by every flow that creates plans (AI, templates, duplicates).
+func insertPlan(ctx context.Context, tx pgx.Tx, uid uuid.UUID, p newPlan) (string, time.Time, error) {
+	var planID string
+	var createdAt time.Time
+
+	// Ensure user exists (for FK plans.user_id -> users.id)
+	_, err := tx.Exec(ctx, `
+		insert into public.users (id)
+		values ($1)
+		on conflict (id) do nothing
+	`, uid)
+	if err != nil {
+		return "", createdAt, err
+	}
+
+	var goalType *string
+	if p.GoalType != "" {
+		goalType = &p.GoalType
+	}
+
+	err = tx.QueryRow(ctx, `
+		insert into public.plans (user_id, title, days, daily_minutes, goal_type, source_plan_id)
+		values ($1, $2, $3, $4, $5, $6)
+		returning id, created_at
+	`, uid, p.Title, p.Days, p.DailyMinutes, goalType, p.SourcePlanID).Scan(&planID, &createdAt)
+	if err != nil {
+		return "", createdAt, err
+	}
+
+	_, err = tx.Exec(ctx, `
+		insert into public.plan_members (plan_id, user_id, role)
+		values ($1, $2, 'owner')
+	`, planID, uid)
+	if err != nil {
+		return "", createdAt, err
+	}
+
+	for _, d := range p.Items {
+		stepsJSON, _ := json.Marshal(d.Steps)
+		_, err = tx.Exec(ctx, `
+			insert into public.plan_days (plan_id, day_number, focus, steps, is_done)
+			values ($1, $2, $3, $4, $5)
+		`, planID, d.DayNumber, d.Focus, stepsJSON, d.IsDone)
+		if err != nil {
+			return "", createdAt, err
+		}
+	}
+
+	return planID, createdAt, nil
+}
+
+// fakePlanDay is the no-cost stand-in for an AI day (USE_FAKE_AI).
+func fakePlanDay(dayNumber, dailyMinutes int) PlanDay {
+	// minutes allocation (match your AI rule idea)
+	core, mom, bad := minutesBudget(dailyMinutes)
+
+	return PlanDay{
+		DayNumber: dayNumber,
+		Focus:     "",
+		Steps: []PlanDayStep{
+			{
+				Title:       "[CORE] Ship one meaningful chunk",
+				Minutes:     core,
+				Deliverable: "1 tangible output (commit / doc / file) for Day " + strconv.Itoa(dayNumber),
+				DoneDef:     "You can point to it and say 'this exists now'.",
+			},
+			{
+				Title:       "[MOMENTUM] Prep the next move",
+				Minutes:     mom,
+				Deliverable: "A short note: next step + blockers",
+				DoneDef:     "A note exists with 1 next step and 1 blocker.",
+			},
+			{
+				Title:       "[BAD DAY] Keep the streak alive",
+				Minutes:     bad,
+				Deliverable: "A 1-line progress log",
+				DoneDef:     "One line written: what you touched today.",
+			},
+		},
+	}
+}
+
+func planDayFromAI(d ai.PlanDay) PlanDay {
+	steps := make([]PlanDayStep, 0, len(d.Steps))
+	for _, s := range d.Steps {
+		steps = append(steps, PlanDayStep{
+			Title:       s.Title,
+			Minutes:     s.Minutes,
+			Deliverable: s.Deliverable,
+			DoneDef:     s.DoneDefinition,
+		})
+	}
+	return PlanDay{
+		DayNumber: d.DayNumber,
+		Focus:     d.Focus,
+		Steps:     steps,
+	}
+}
+
+func handleCreatePlan(db *pgxpool.Pool, cfg config.Config, cache *splitcache.Cache) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var req CreatePlanRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "invalid json body", http.StatusBadRequest)
+			httpError(w, "invalid json body", http.StatusBadRequest)
 			return
 		}
 		if req.Title == "" || req.Days <= 0 || req.Days > 60 || req.DailyMinutes <= 0 {
-			http.Error(w, "invalid input", http.StatusBadRequest)
+			httpError(w, "invalid input", http.StatusBadRequest)
+			return
+		}
+
+		uid, ok := userIDFromCtx(r.Context())
+		if !ok {
+			httpError(w, "missing user", http.StatusUnauthorized)
 			return
 		}
 
@@ -71,34 +227,18 @@ func handleCreatePlan(db *pgxpool.Pool, cfg config.Config) http.HandlerFunc {
 		}
 
 		// ---- 1) Produce meta + plan items (fake or real) ----
-		type metaPayload struct {
-			SplitterQuote     string   `json:"splitter_quote"`
-			Mode              string   `json:"mode"`
-			GoalType          string   `json:"goal_type"`
-			OriginalGoal      string   `json:"original_goal"`
-			FinalGoal         string   `json:"final_goal"`
-			Changed           bool     `json:"changed"`
-			WhyThisAdjustment string   `json:"why_this_adjustment"`
-			SuccessRule       string   `json:"success_rule"`
-			Assumptions       []string `json:"assumptions"`
-			RiskNotes         []string `json:"risk_notes"`
-		}
-
-		type planPayload struct {
-			ID           string    `json:"id"`
-			Title        string    `json:"title"`
-			Days         int       `json:"days"`
-			DailyMinutes int       `json:"daily_minutes"`
-			CreatedAt    time.Time `json:"created_at,omitempty"`
-			Items        []PlanDay `json:"items"`
-		}
+		var meta SplitterMeta
+		var plan CreatedPlan
+		var aiClient *ai.Client
+		planID := ""
 
-		var meta metaPayload
-		var plan planPayload
+		// Tokens are spent even when the plan isn't saved in the end.
+		cfg := budgetedAI(r.Context(), db, cfg)
+		defer func() { recordAIUsage(r.Context(), db, cfg, uid, planID, aiOpCreatePlan, aiClient) }()
 
 		if cfg.UseFakeAI {
 			// ✅ Fake splitter output (no cost)
-			meta = metaPayload{
+			meta = SplitterMeta{
 				SplitterQuote:     "Small wins compound faster than perfect plans.",
 				Mode:              "normal",
 				GoalType:          "Build",
@@ -111,71 +251,53 @@ func handleCreatePlan(db *pgxpool.Pool, cfg config.Config) http.HandlerFunc {
 				RiskNotes:         []string{"If time gets tight, only do [BAD DAY] to keep the streak alive."},
 			}
 
-			// minutes allocation (match your AI rule idea)
-			D := req.DailyMinutes
-			bad := clampInt(int(math.Round(float64(D)*0.15)), 3, 10)
-			mom := clampInt(int(math.Round(float64(D)*0.25)), 10, 25)
-			core := D - bad - mom
-			if core < 10 {
-				need := 10 - core
-				mom -= need
-				if mom < 10 {
-					mom = 10
-				}
-				core = D - bad - mom
-			}
-
 			items := make([]PlanDay, 0, planDays)
 			for i := 1; i <= planDays; i++ {
-				items = append(items, PlanDay{
-					DayNumber: i,
-					Focus:     "",
-					Steps: []PlanDayStep{
-						{
-							Title:       "[CORE] Ship one meaningful chunk",
-							Minutes:     core,
-							Deliverable: "1 tangible output (commit / doc / file) for Day " + strconv.Itoa(i),
-							DoneDef:     "You can point to it and say 'this exists now'.",
-						},
-						{
-							Title:       "[MOMENTUM] Prep the next move",
-							Minutes:     mom,
-							Deliverable: "A short note: next step + blockers",
-							DoneDef:     "A note exists with 1 next step and 1 blocker.",
-						},
-						{
-							Title:       "[BAD DAY] Keep the streak alive",
-							Minutes:     bad,
-							Deliverable: "A 1-line progress log",
-							DoneDef:     "One line written: what you touched today.",
-						},
-					},
-				})
+				items = append(items, fakePlanDay(i, req.DailyMinutes))
 			}
 
-			plan = planPayload{
+			plan = CreatedPlan{
 				Title:        req.Title,
 				Days:         planDays,
 				DailyMinutes: req.DailyMinutes,
 				Items:        items,
 			}
 		} else {
-			// ✅ Real AI (costs money)
-			aiClient := ai.NewClient(cfg.OpenAIKey, cfg.OpenAIModel)
-
+			// ✅ Real AI (costs money), unless the same request was answered before
 			ctx, cancel := context.WithTimeout(r.Context(), 40*time.Second)
 			defer cancel()
 
-			tf := planDays
-			dm := req.DailyMinutes
-			out, err := aiClient.GenerateSplitter(ctx, req.Title, &tf, &dm)
-			if err != nil {
-				http.Error(w, "ai generation failed: "+err.Error(), http.StatusBadGateway)
-				return
+			key := splitcache.Key{
+				Goal:          req.Title,
+				Days:          planDays,
+				DailyMinutes:  req.DailyMinutes,
+				PromptVersion: ai.SplitterPromptVersion,
+				Model:         cfg.OpenAIModel,
+			}
+			out, hit := cache.Get(ctx, key)
+			if !hit {
+				if !takeAIQuota(ctx, w, db, cfg, uid) {
+					return
+				}
+				aiClient = ai.NewClient(cfg.OpenAIKey, cfg.OpenAIModel)
+
+				tf := planDays
+				dm := req.DailyMinutes
+				var err error
+				out, err = aiClient.GenerateSplitter(ctx, req.Title, &tf, &dm)
+				if err != nil {
+					refundAIQuota(ctx, db, cfg, uid)
+					upstreamError(w, "ai generation failed", err)
+					return
+				}
+				cache.Put(ctx, key, out)
+			} else {
+				// The cached answer was for someone else's wording.
+				out.Meta.OriginalGoal = req.Title
 			}
 
 			// Map meta
-			meta = metaPayload{
+			meta = SplitterMeta{
 				SplitterQuote:     out.Meta.SplitterQuote,
 				Mode:              out.Meta.Mode,
 				GoalType:          out.Meta.GoalType,
@@ -186,28 +308,16 @@ func handleCreatePlan(db *pgxpool.Pool, cfg config.Config) http.HandlerFunc {
 				SuccessRule:       out.Meta.SuccessRule,
 				Assumptions:       out.Meta.Assumptions,
 				RiskNotes:         out.Meta.RiskNotes,
+				Cached:            hit,
 			}
 
 			// Map plan (note: use AI final title)
 			items := make([]PlanDay, 0, len(out.Plan.Items))
 			for _, d := range out.Plan.Items {
-				steps := make([]PlanDayStep, 0, len(d.Steps))
-				for _, s := range d.Steps {
-					steps = append(steps, PlanDayStep{
-						Title:       s.Title,
-						Minutes:     s.Minutes,
-						Deliverable: s.Deliverable,
-						DoneDef:     s.DoneDefinition,
-					})
-				}
-				items = append(items, PlanDay{
-					DayNumber: d.DayNumber,
-					Focus:     d.Focus,
-					Steps:     steps,
-				})
+				items = append(items, planDayFromAI(d))
 			}
 
-			plan = planPayload{
+			plan = CreatedPlan{
 				Title:        out.Plan.Title,
 				Days:         out.Plan.Days,
 				DailyMinutes: out.Plan.DailyMinutes,
@@ -216,62 +326,34 @@ func handleCreatePlan(db *pgxpool.Pool, cfg config.Config) http.HandlerFunc {
 		}
 
 		// ---- 2) DB write (if db connected) ----
-		planID := ""
 		createdAt := time.Time{}
 
-		uid, ok := userIDFromCtx(r.Context())
-		if !ok {
-			http.Error(w, "missing user", http.StatusUnauthorized)
-			return
-		}
-
 		if db != nil {
 			ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
 			defer cancel()
 
 			tx, err := db.Begin(ctx)
 			if err != nil {
-				http.Error(w, "begin tx failed", http.StatusInternalServerError)
+				internalError(w, "begin tx failed", err)
 				return
 			}
 			defer func() { _ = tx.Rollback(ctx) }()
 
-			// 0) Ensure user exists (for FK plans.user_id -> users.id)
-			_, err = tx.Exec(ctx, `
-			insert into public.users (id)
-			values ($1)
-			on conflict (id) do nothing
-			`, uid)
-			if err != nil {
-				http.Error(w, "ensure user failed", http.StatusInternalServerError)
-				return
-			}
-
 			// IMPORTANT: store final title (plan.Title), not req.Title
-			err = tx.QueryRow(ctx, `
-    insert into public.plans (user_id, title, days, daily_minutes)
-    values ($1, $2, $3, $4)
-    returning id, created_at
-  `, uid, plan.Title, plan.Days, plan.DailyMinutes).Scan(&planID, &createdAt)
+			planID, createdAt, err = insertPlan(ctx, tx, uid, newPlan{
+				Title:        plan.Title,
+				Days:         plan.Days,
+				DailyMinutes: plan.DailyMinutes,
+				GoalType:     meta.GoalType,
+				Items:        plan.Items,
+			})
 			if err != nil {
-				http.Error(w, "insert plan failed", http.StatusInternalServerError)
+				internalError(w, "insert plan failed", err)
 				return
 			}
 
-			for _, d := range plan.Items {
-				stepsJSON, _ := json.Marshal(d.Steps)
-				_, err = tx.Exec(ctx, `
-      insert into public.plan_days (plan_id, day_number, focus, steps)
-      values ($1,$2,$3,$4)
-    `, planID, d.DayNumber, d.Focus, stepsJSON)
-				if err != nil {
-					http.Error(w, "insert plan_days failed", http.StatusInternalServerError)
-					return
-				}
-			}
-
 			if err := tx.Commit(ctx); err != nil {
-				http.Error(w, "commit failed", http.StatusInternalServerError)
+				internalError(w, "commit failed", err)
 				return
 			}
 		}
@@ -282,10 +364,7 @@ func handleCreatePlan(db *pgxpool.Pool, cfg config.Config) http.HandlerFunc {
 		}
 
 		// ---- 3) Response: meta + plan (frontend can show modal immediately) ----
-		resp := map[string]any{
-			"meta": meta,
-			"plan": plan,
-		}
+		resp := CreatePlanResponse{Meta: meta, Plan: plan}
 
 		w.Header().Set("Content-Type", "application/json")
 		_ = json.NewEncoder(w).Encode(resp)
@@ -0,0 +1,79 @@
+package httpapi
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+)
+
+// planRole is a member's role on a plan. Roles are ordered:
+// viewer < editor < owner.
+type planRole string
+
+const (
+	roleNone   planRole = ""
+	roleViewer planRole = "viewer"
+	roleEditor planRole = "editor"
+	roleOwner  planRole = "owner"
+)
+
+func (r planRole) rank() int {
+	switch r {
+	case roleViewer:
+		return 1
+	case roleEditor:
+		return 2
+	case roleOwner:
+		return 3
+	}
+	return 0
+}
+
+func (r planRole) atLeast(min planRole) bool {
+	return r.rank() >= min.rank()
+}
+
+// planRoleFor returns uid's role on planID, or roleNone when the plan
+// does not exist, is in the trash, or uid is not a member.
+func planRoleFor(ctx context.Context, q querier, planID string, uid uuid.UUID) (planRole, error) {
+	if _, err := uuid.Parse(planID); err != nil {
+		return roleNone, nil
+	}
+
+	var role string
+	err := q.QueryRow(ctx, `
+		select m.role from public.plan_members m
+		join public.plans p on p.id = m.plan_id
+		where m.plan_id = $1 and m.user_id = $2 and p.deleted_at is null
+	`, planID, uid).Scan(&role)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return roleNone, nil
+		}
+		return roleNone, err
+	}
+	return planRole(role), nil
+}
+
+// requirePlanRole checks that uid has at least min on planID and writes
+// the error response when not. Non-members get 404 so plan ids don't leak;
+// members with too small a role get 403.
+func requirePlanRole(ctx context.Context, w http.ResponseWriter, q querier, planID string, uid uuid.UUID, min planRole) (planRole, bool) {
+	role, err := planRoleFor(ctx, q, planID, uid)
+	if err != nil {
+		internalError(w, "permission check failed", err)
+		return roleNone, false
+	}
+	if role == roleNone {
+		httpError(w, "plan not found", http.StatusNotFound)
+		return roleNone, false
+	}
+	if !role.atLeast(min) {
+		httpError(w, "forbidden", http.StatusForbidden)
+		return role, false
+	}
+	return role, true
+}
@@ -0,0 +1,232 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"sliceapp-backend/internal/realtime"
+)
+
+const maxBatchOps = 100
+
+// DayOperation is one entry of a batch. Only the field its op needs is
+// read: is_done for set_done, focus for set_focus, steps for
+// replace_steps. clear puts the day back to pending.
+type DayOperation struct {
+	Op     string          `json:"op"`
+	Day    int             `json:"day"`
+	IsDone *bool           `json:"is_done,omitempty"`
+	Focus  *string         `json:"focus,omitempty"`
+	Steps  json.RawMessage `json:"steps,omitempty"` // array of PlanDayStep
+}
+
+type BatchDaysRequest struct {
+	Operations []DayOperation `json:"operations"`
+}
+
+type DayOperationResult struct {
+	Index     int    `json:"index"`
+	Op        string `json:"op"`
+	Day       int    `json:"day"`
+	OK        bool   `json:"ok"`
+	IsDone    *bool  `json:"is_done,omitempty"`
+	DayStatus string `json:"day_status,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+type BatchDaysResponse struct {
+	OK      bool                 `json:"ok"`
+	PlanID  string               `json:"plan_id"`
+	Status  string               `json:"status"`
+	Version int                  `json:"version"`
+	Results []DayOperationResult `json:"results"`
+}
+
+// dayOpMembers maps each batch op to the day patch member it writes.
+var dayOpMembers = map[string]string{
+	"set_done":      "is_done",
+	"set_focus":     "focus",
+	"replace_steps": "steps",
+	"clear":         "status",
+}
+
+// dayPatchForOp turns one batch operation into a day patch. Errors are
+// reported against operations.<i>.
+func dayPatchForOp(i int, op DayOperation) (*dayPatch, []FieldError) {
+	prefix := fmt.Sprintf("operations.%d.", i)
+	member, ok := dayOpMembers[op.Op]
+	if !ok {
+		return nil, []FieldError{{Field: prefix + "op", Message: "must be set_done, set_focus, replace_steps or clear"}}
+	}
+	if op.Day <= 0 || op.Day > maxPlanDays {
+		return nil, []FieldError{{Field: prefix + "day", Message: fmt.Sprintf("must be between 1 and %d", maxPlanDays)}}
+	}
+
+	var raw json.RawMessage
+	switch op.Op {
+	case "set_done":
+		if op.IsDone != nil {
+			raw, _ = json.Marshal(*op.IsDone)
+		}
+	case "set_focus":
+		if op.Focus != nil {
+			raw, _ = json.Marshal(*op.Focus)
+		}
+	case "replace_steps":
+		raw = op.Steps
+	case "clear":
+		raw, _ = json.Marshal(dayPending)
+	}
+	if raw == nil {
+		return nil, []FieldError{{Field: prefix + member, Message: op.Op + " needs " + member}}
+	}
+
+	p, errs := dayPatchFromMembers(map[string]json.RawMessage{member: raw})
+	for j, e := range errs {
+		if e.Step != nil {
+			e.Field = fmt.Sprintf("steps.%d.%s", *e.Step, e.Field)
+			e.Step = nil
+		}
+		e.Field = prefix + e.Field
+		errs[j] = e
+	}
+	return p, errs
+}
+
+// handleBatchPlanDays: POST /plans/{id}/days:batch applies a list of day
+// operations in one transaction. Either every operation is applied or
+// none is; the response has one result per operation either way.
+func handleBatchPlanDays(db *pgxpool.Pool, hub *realtime.Broker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if db == nil {
+			httpError(w, "db not connected", http.StatusServiceUnavailable)
+			return
+		}
+		uid, ok := userIDFromCtx(r.Context())
+		if !ok {
+			httpError(w, "missing user", http.StatusUnauthorized)
+			return
+		}
+
+		planID := chi.URLParam(r, "id")
+
+		var req BatchDaysRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			httpError(w, "invalid json body", http.StatusBadRequest)
+			return
+		}
+		if len(req.Operations) == 0 {
+			httpError(w, "no operations", http.StatusBadRequest)
+			return
+		}
+		if len(req.Operations) > maxBatchOps {
+			httpError(w, fmt.Sprintf("at most %d operations per batch", maxBatchOps), http.StatusBadRequest)
+			return
+		}
+
+		patches := make([]*dayPatch, len(req.Operations))
+		var fieldErrs []FieldError
+		for i, op := range req.Operations {
+			p, errs := dayPatchForOp(i, op)
+			fieldErrs = append(fieldErrs, errs...)
+			patches[i] = p
+		}
+		if len(fieldErrs) > 0 {
+			writeValidationErrors(w, fieldErrs)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 15*time.Second)
+		defer cancel()
+
+		tx, err := db.Begin(ctx)
+		if err != nil {
+			internalError(w, "begin tx failed", err)
+			return
+		}
+		defer func() { _ = tx.Rollback(ctx) }()
+
+		if _, ok := requirePlanRole(ctx, w, tx, planID, uid, roleEditor); !ok {
+			return
+		}
+		if !checkIfMatch(ctx, w, r, tx, planID) {
+			return
+		}
+
+		results := make([]DayOperationResult, len(req.Operations))
+		for i, op := range req.Operations {
+			results[i] = DayOperationResult{Index: i, Op: op.Op, Day: op.Day}
+		}
+		applied := make([]*patchedDay, len(req.Operations))
+		// Days a set_done op touched, with the status they end up in.
+		marked := map[int]string{}
+		for i, op := range req.Operations {
+			day, err := applyDayPatch(ctx, tx, planID, op.Day, uid, "batch_"+op.Op, patches[i])
+			if err != nil {
+				internalError(w, "update failed", err)
+				return
+			}
+			if day == nil {
+				// The transaction is rolled back, so no result reports ok.
+				results[i].Error = "plan_day not found"
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(http.StatusUnprocessableEntity)
+				_ = json.NewEncoder(w).Encode(map[string]any{
+					"error": APIError{
+						Code:      "batch_failed",
+						Message:   fmt.Sprintf("operation %d failed; nothing was applied", i),
+						RequestID: w.Header().Get(requestIDHeader),
+					},
+					"results": results,
+				})
+				return
+			}
+			applied[i] = day
+			if _, ok := marked[op.Day]; ok || op.Op == "set_done" {
+				marked[op.Day] = day.Status
+			}
+		}
+		for i, day := range applied {
+			results[i].OK = true
+			results[i].IsDone = &day.IsDone
+			results[i].DayStatus = day.Status
+		}
+
+		status, err := refreshPlanCompletion(ctx, tx, planID)
+		if err != nil {
+			internalError(w, "update status failed", err)
+			return
+		}
+		version, err := touchPlan(ctx, tx, planID)
+		if err != nil {
+			internalError(w, "bump version failed", err)
+			return
+		}
+
+		if err := tx.Commit(ctx); err != nil {
+			internalError(w, "commit failed", err)
+			return
+		}
+
+		for d, st := range marked {
+			if dayCountsDone(st) {
+				recordDayDoneEvent(ctx, db, uid, planID, d)
+			}
+		}
+		publishPlanEvent(ctx, db, hub, realtime.Event{
+			Type: "plan.updated", PlanID: planID, Version: version, ActorID: uid.String(),
+		})
+
+		w.Header().Set("ETag", planETag(version))
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(BatchDaysResponse{
+			OK: true, PlanID: planID, Status: status, Version: version, Results: results,
+		})
+	}
+}
@@ -0,0 +1,102 @@
+package httpapi
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+func TestDayPatchForOpRange(t *testing.T) {
+	for _, day := range []int{0, maxPlanDays + 1} {
+		_, errs := dayPatchForOp(0, DayOperation{Op: "set_focus", Day: day, Focus: new(string)})
+		if len(errs) != 1 || errs[0].Field != "operations.0.day" {
+			t.Errorf("day %d: errs = %+v", day, errs)
+		}
+	}
+	if _, errs := dayPatchForOp(0, DayOperation{Op: "set_focus", Day: maxPlanDays, Focus: new(string)}); len(errs) > 0 {
+		t.Errorf("day %d rejected: %+v", maxPlanDays, errs)
+	}
+}
+
+// A failing operation rolls back the ones before it.
+func TestBatchPlanDaysAllOrNothing(t *testing.T) {
+	db := testDB(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	uid := uuid.New()
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	planID, _, err := insertPlan(ctx, tx, uid, newPlan{
+		Title: "batch", Days: 2, DailyMinutes: 30,
+		Items: []PlanDay{{DayNumber: 1, Focus: "one", Steps: []PlanDayStep{}}, {DayNumber: 2, Focus: "two", Steps: []PlanDayStep{}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_, _ = db.Exec(context.Background(), `delete from public.plans where id = $1`, planID)
+		_, _ = db.Exec(context.Background(), `delete from public.users where id = $1`, uid)
+	})
+
+	r := chi.NewRouter()
+	r.Post("/plans/{id}/days:batch", handleBatchPlanDays(db, nil))
+	batch := func(body string) int {
+		req := httptest.NewRequest(http.MethodPost, "/plans/"+planID+"/days:batch", strings.NewReader(body))
+		req = req.WithContext(context.WithValue(req.Context(), userIDKey, uid))
+		rec := httptest.NewRecorder()
+		r.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	focus := func(day int) string {
+		var f string
+		if err := db.QueryRow(ctx, `
+			select focus from public.plan_days where plan_id = $1 and day_number = $2
+		`, planID, day).Scan(&f); err != nil {
+			t.Fatal(err)
+		}
+		return f
+	}
+
+	code := batch(`{"operations":[
+		{"op":"set_focus","day":1,"focus":"changed"},
+		{"op":"set_done","day":2,"is_done":true},
+		{"op":"set_focus","day":3,"focus":"missing"}
+	]}`)
+	if code != http.StatusUnprocessableEntity {
+		t.Fatalf("failing batch = %d, want 422", code)
+	}
+	if f := focus(1); f != "one" {
+		t.Errorf("day 1 focus = %q after a failed batch", f)
+	}
+	var done bool
+	if err := db.QueryRow(ctx, `
+		select is_done from public.plan_days where plan_id = $1 and day_number = 2
+	`, planID).Scan(&done); err != nil {
+		t.Fatal(err)
+	}
+	if done {
+		t.Error("day 2 marked done after a failed batch")
+	}
+
+	if code := batch(`{"operations":[
+		{"op":"set_focus","day":1,"focus":"changed"},
+		{"op":"set_focus","day":2,"focus":"also"}
+	]}`); code != http.StatusOK {
+		t.Fatalf("good batch = %d", code)
+	}
+	if f1, f2 := focus(1), focus(2); f1 != "changed" || f2 != "also" {
+		t.Errorf("focus = %q, %q after a good batch", f1, f2)
+	}
+}
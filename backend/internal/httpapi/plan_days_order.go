@@ -0,0 +1,437 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"sliceapp-backend/internal/ai"
+	"sliceapp-backend/internal/config"
+	"sliceapp-backend/internal/realtime"
+)
+
+const maxPlanDays = 365
+
+// Renumbering parks rows above this offset first, so the unique
+// (plan_id, day_number) index never sees two rows on the same number.
+// Claims and member completions follow via ON UPDATE CASCADE.
+const dayParkOffset = 1000
+
+type InsertDayRequest struct {
+	// Position is where the new day goes (1..days+1); omit to append.
+	Position *int          `json:"position"`
+	Focus    string        `json:"focus"`
+	Steps    []PlanDayStep `json:"steps"`
+	// Generate asks the splitter for the day's content; Focus and Steps
+	// are ignored.
+	Generate bool `json:"generate"`
+}
+
+type MoveDayRequest struct {
+	To int `json:"to"`
+}
+
+// dayOpError is a client error from inside a reorder transaction.
+type dayOpError struct {
+	status int
+	msg    string
+}
+
+func (e *dayOpError) Error() string { return e.msg }
+
+func countPlanDays(ctx context.Context, q querier, planID string) (int, error) {
+	var n int
+	err := q.QueryRow(ctx, `
+		select count(*) from public.plan_days where plan_id = $1
+	`, planID).Scan(&n)
+	return n, err
+}
+
+// shiftDays moves days from..to (inclusive) by delta.
+func shiftDays(ctx context.Context, q querier, planID string, from, to, delta int) error {
+	if from > to {
+		return nil
+	}
+	_, err := q.Exec(ctx, `
+		update public.plan_days set day_number = day_number + $4 + $5
+		where plan_id = $1 and day_number between $2 and $3
+	`, planID, from, to, delta, dayParkOffset)
+	if err != nil {
+		return err
+	}
+	return unparkDays(ctx, q, planID)
+}
+
+// moveDay puts day from at position to, sliding the days in between.
+func moveDay(ctx context.Context, q querier, planID string, from, to int) error {
+	_, err := q.Exec(ctx, `
+		update public.plan_days
+		set day_number = $4 + case
+		    when day_number = $2 then $3
+		    when $2 < $3 then day_number - 1
+		    else day_number + 1 end
+		where plan_id = $1 and day_number between least($2, $3) and greatest($2, $3)
+	`, planID, from, to, dayParkOffset)
+	if err != nil {
+		return err
+	}
+	return unparkDays(ctx, q, planID)
+}
+
+func unparkDays(ctx context.Context, q querier, planID string) error {
+	_, err := q.Exec(ctx, `
+		update public.plan_days set day_number = day_number - $2
+		where plan_id = $1 and day_number > $2
+	`, planID, dayParkOffset)
+	return err
+}
+
+// settleDayTombstones fixes sync tombstones after a renumber: numbers that
+// exist again must not read as deleted, and numbers past the new end must
+// (with a fresh change_seq, after the renumbered rows).
+func settleDayTombstones(ctx context.Context, q querier, planID string, oldCount, newCount int) error {
+	_, err := q.Exec(ctx, `
+		delete from public.sync_tombstones
+		where kind = 'day' and plan_id = $1 and day_number <= greatest($2::int, $3::int)
+	`, planID, newCount, oldCount)
+	if err != nil || oldCount <= newCount {
+		return err
+	}
+	_, err = q.Exec(ctx, `
+		insert into public.sync_tombstones (kind, plan_id, day_number, user_ids)
+		select 'day', $1, n, (select array_agg(user_id) from public.plan_members where plan_id = $1)
+		from generate_series($2::int, $3::int) n
+		where exists (select 1 from public.plan_members where plan_id = $1)
+	`, planID, newCount+1, oldCount)
+	return err
+}
+
+// reorderDays runs op inside the shared bookkeeping for structural day
+// edits: role and If-Match checks, a whole-plan revision, plans.days,
+// tombstones, status, version and the realtime event. op gets the current
+// day count and returns the new one.
+func reorderDays(w http.ResponseWriter, r *http.Request, db *pgxpool.Pool, hub *realtime.Broker, action string,
+	op func(ctx context.Context, tx pgx.Tx, count int) (int, error)) {
+	if db == nil {
+		httpError(w, "db not connected", http.StatusServiceUnavailable)
+		return
+	}
+	uid, ok := userIDFromCtx(r.Context())
+	if !ok {
+		httpError(w, "missing user", http.StatusUnauthorized)
+		return
+	}
+	planID := chi.URLParam(r, "id")
+
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		internalError(w, "begin tx failed", err)
+		return
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	if _, ok := requirePlanRole(ctx, w, tx, planID, uid, roleEditor); !ok {
+		return
+	}
+	if !checkIfMatch(ctx, w, r, tx, planID) {
+		return
+	}
+
+	before, err := snapshotPlan(ctx, tx, planID)
+	if err != nil {
+		internalError(w, "snapshot failed", err)
+		return
+	}
+	count := len(before.Items)
+
+	newCount, err := op(ctx, tx, count)
+	if err != nil {
+		var opErr *dayOpError
+		if errors.As(err, &opErr) {
+			httpError(w, opErr.msg, opErr.status)
+			return
+		}
+		internalError(w, action+" failed", err)
+		return
+	}
+
+	if _, err := tx.Exec(ctx, `
+		update public.plans set days = $2 where id = $1
+	`, planID, newCount); err != nil {
+		internalError(w, "update failed", err)
+		return
+	}
+	if err := settleDayTombstones(ctx, tx, planID, count, newCount); err != nil {
+		internalError(w, "update failed", err)
+		return
+	}
+
+	after, err := snapshotPlan(ctx, tx, planID)
+	if err != nil {
+		internalError(w, "snapshot failed", err)
+		return
+	}
+	if err := recordRevision(ctx, tx, planID, nil, uid, action, before, after); err != nil {
+		internalError(w, "record revision failed", err)
+		return
+	}
+	status, err := refreshPlanCompletion(ctx, tx, planID)
+	if err != nil {
+		internalError(w, "update status failed", err)
+		return
+	}
+	version, err := touchPlan(ctx, tx, planID)
+	if err != nil {
+		internalError(w, "bump version failed", err)
+		return
+	}
+
+	resp, err := loadPlanDetail(ctx, tx, planID)
+	if err != nil {
+		internalError(w, "load plan failed", err)
+		return
+	}
+	resp.Status = status
+
+	if err := tx.Commit(ctx); err != nil {
+		internalError(w, "commit failed", err)
+		return
+	}
+
+	publishPlanEvent(ctx, db, hub, realtime.Event{
+		Type: "plan.updated", PlanID: planID, Version: version, ActorID: uid.String(),
+	})
+
+	w.Header().Set("ETag", planETag(version))
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// generateDay asks the splitter (or the fake one) for the content of a
+// new day at position. It runs before the write transaction so the AI
+// call doesn't hold locks.
+func generateDay(ctx context.Context, db *pgxpool.Pool, cfg config.Config, uid uuid.UUID, planID string, position int) (*PlanDay, error) {
+	detail, err := loadPlanDetail(ctx, db, planID)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.UseFakeAI {
+		d := fakePlanDay(position, detail.DailyMinutes)
+		return &d, nil
+	}
+
+	dc := ai.DayContext{
+		PlanTitle:    detail.Title,
+		DailyMinutes: detail.DailyMinutes,
+		DayNumber:    position,
+		Days:         len(detail.Items) + 1,
+	}
+	for i := range detail.Items {
+		it := detail.Items[i]
+		switch it.DayNumber {
+		case position - 1:
+			dc.Prev = aiDayFromPlanDay(it)
+		case position:
+			dc.Next = aiDayFromPlanDay(it)
+		}
+	}
+
+	client := ai.NewClient(cfg.OpenAIKey, cfg.OpenAIModel)
+	out, err := client.GenerateDay(ctx, dc)
+	recordAIUsage(ctx, db, cfg, uid, planID, aiOpGenerateDay, client)
+	if err != nil {
+		return nil, err
+	}
+	d := planDayFromAI(*out)
+	return &d, nil
+}
+
+func aiDayFromPlanDay(d PlanDay) *ai.PlanDay {
+	out := &ai.PlanDay{DayNumber: d.DayNumber, Focus: d.Focus}
+	for _, s := range d.Steps {
+		out.Steps = append(out.Steps, ai.PlanDayStep{
+			Title:          s.Title,
+			Minutes:        s.Minutes,
+			Deliverable:    s.Deliverable,
+			DoneDefinition: s.DoneDef,
+		})
+	}
+	return out
+}
+
+// insertPosition resolves where a new day goes in a plan of count days;
+// nil means at the end.
+func insertPosition(position *int, count int) (int, *dayOpError) {
+	pos := count + 1
+	if position != nil {
+		pos = *position
+	}
+	if pos < 1 || pos > count+1 {
+		return 0, &dayOpError{http.StatusBadRequest, "position must be between 1 and days+1"}
+	}
+	if count+1 > maxPlanDays {
+		return 0, &dayOpError{http.StatusBadRequest, "plan already has the maximum number of days"}
+	}
+	return pos, nil
+}
+
+// handleInsertPlanDay: POST /plans/{id}/days inserts a blank, given or
+// generated day and renumbers the ones after it.
+func handleInsertPlanDay(db *pgxpool.Pool, cfg config.Config, hub *realtime.Broker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if db == nil {
+			httpError(w, "db not connected", http.StatusServiceUnavailable)
+			return
+		}
+		uid, ok := userIDFromCtx(r.Context())
+		if !ok {
+			httpError(w, "missing user", http.StatusUnauthorized)
+			return
+		}
+		planID := chi.URLParam(r, "id")
+
+		var req InsertDayRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			httpError(w, "invalid json body", http.StatusBadRequest)
+			return
+		}
+		if errs := validateSteps(req.Steps); len(errs) > 0 {
+			writeValidationErrors(w, errs)
+			return
+		}
+
+		day := PlanDay{Focus: req.Focus, Steps: req.Steps}
+		if day.Steps == nil {
+			day.Steps = []PlanDayStep{}
+		}
+
+		if req.Generate {
+			ctx, cancel := context.WithTimeout(r.Context(), 40*time.Second)
+			defer cancel()
+
+			cfg := budgetedAI(ctx, db, cfg)
+
+			if _, ok := requirePlanRole(ctx, w, db, planID, uid, roleEditor); !ok {
+				return
+			}
+			// Everything that can turn the insert down is checked before
+			// the quota is spent; reorderDays checks again under the lock.
+			count, err := countPlanDays(ctx, db, planID)
+			if err != nil {
+				internalError(w, "count days failed", err)
+				return
+			}
+			pos, opErr := insertPosition(req.Position, count)
+			if opErr != nil {
+				httpError(w, opErr.msg, opErr.status)
+				return
+			}
+			if !checkIfMatch(ctx, w, r, db, planID) {
+				return
+			}
+			if !cfg.UseFakeAI && !takeAIQuota(ctx, w, db, cfg, uid) {
+				return
+			}
+			gen, err := generateDay(ctx, db, cfg, uid, planID, pos)
+			if err != nil {
+				if !cfg.UseFakeAI {
+					refundAIQuota(ctx, db, cfg, uid)
+				}
+				upstreamError(w, "ai generation failed", err)
+				return
+			}
+			day = *gen
+		}
+
+		reorderDays(w, r, db, hub, "insert_day", func(ctx context.Context, tx pgx.Tx, count int) (int, error) {
+			pos, opErr := insertPosition(req.Position, count)
+			if opErr != nil {
+				return 0, opErr
+			}
+
+			if err := shiftDays(ctx, tx, planID, pos, count, 1); err != nil {
+				return 0, err
+			}
+			stepsJSON, _ := json.Marshal(day.Steps)
+			if _, err := tx.Exec(ctx, `
+				insert into public.plan_days (plan_id, day_number, focus, steps, is_done)
+				values ($1, $2, $3, $4, false)
+			`, planID, pos, day.Focus, stepsJSON); err != nil {
+				return 0, err
+			}
+			return count + 1, nil
+		})
+	}
+}
+
+// handleRemovePlanDay: DELETE /plans/{id}/days/{day} deletes a day and
+// closes the gap.
+func handleRemovePlanDay(db *pgxpool.Pool, hub *realtime.Broker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		planID := chi.URLParam(r, "id")
+		dayNumber, ok := parseDayParam(r)
+		if !ok {
+			httpError(w, "invalid day_number", http.StatusBadRequest)
+			return
+		}
+
+		reorderDays(w, r, db, hub, "remove_day", func(ctx context.Context, tx pgx.Tx, count int) (int, error) {
+			if dayNumber > count {
+				return 0, &dayOpError{http.StatusNotFound, "plan_day not found"}
+			}
+			if count == 1 {
+				return 0, &dayOpError{http.StatusConflict, "a plan needs at least one day"}
+			}
+
+			if _, err := tx.Exec(ctx, `
+				delete from public.plan_days where plan_id = $1 and day_number = $2
+			`, planID, dayNumber); err != nil {
+				return 0, err
+			}
+			if err := shiftDays(ctx, tx, planID, dayNumber+1, count, -1); err != nil {
+				return 0, err
+			}
+			return count - 1, nil
+		})
+	}
+}
+
+// handleMovePlanDay: POST /plans/{id}/days/{day}/move {"to": n}.
+func handleMovePlanDay(db *pgxpool.Pool, hub *realtime.Broker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		planID := chi.URLParam(r, "id")
+		dayNumber, ok := parseDayParam(r)
+		if !ok {
+			httpError(w, "invalid day_number", http.StatusBadRequest)
+			return
+		}
+		var req MoveDayRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			httpError(w, "invalid json body", http.StatusBadRequest)
+			return
+		}
+
+		reorderDays(w, r, db, hub, "move_day", func(ctx context.Context, tx pgx.Tx, count int) (int, error) {
+			if dayNumber > count {
+				return 0, &dayOpError{http.StatusNotFound, "plan_day not found"}
+			}
+			if req.To < 1 || req.To > count {
+				return 0, &dayOpError{http.StatusBadRequest, "to must be between 1 and days"}
+			}
+			if req.To == dayNumber {
+				return count, nil
+			}
+			return count, moveDay(ctx, tx, planID, dayNumber, req.To)
+		})
+	}
+}
@@ -8,50 +8,72 @@ import (
 
 	"github.com/go-chi/chi/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
+
+	"sliceapp-backend/internal/realtime"
 )
 
-func handleDeletePlan(db *pgxpool.Pool) http.HandlerFunc {
+// handleDeletePlan moves a plan to the trash. It stays restorable until
+// the purge job removes it for good (see TRASH_RETENTION_DAYS).
+func handleDeletePlan(db *pgxpool.Pool, hub *realtime.Broker) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if db == nil {
-			http.Error(w, "db not connected", http.StatusServiceUnavailable)
+			httpError(w, "db not connected", http.StatusServiceUnavailable)
 			return
 		}
 		uid, ok := userIDFromCtx(r.Context())
 		if !ok {
-			http.Error(w, "missing user", http.StatusUnauthorized)
+			httpError(w, "missing user", http.StatusUnauthorized)
 			return
 		}
 
 		planID := chi.URLParam(r, "id")
 		if planID == "" {
-			http.Error(w, "missing id", http.StatusBadRequest)
+			httpError(w, "missing id", http.StatusBadRequest)
 			return
 		}
 
 		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
 		defer cancel()
 
-		// If you have ON DELETE CASCADE on plan_days.plan_id,
-		// deleting from plans will automatically delete plan_days.
-		tag, err := db.Exec(ctx, `
-			delete from public.plans
-			 where id = $1 and user_id = $2
-		`, planID, uid)
+		tx, err := db.Begin(ctx)
+		if err != nil {
+			internalError(w, "begin tx failed", err)
+			return
+		}
+		defer func() { _ = tx.Rollback(ctx) }()
 
+		// Only the owner may delete a shared plan.
+		if _, ok := requirePlanRole(ctx, w, tx, planID, uid, roleOwner); !ok {
+			return
+		}
+		if !checkIfMatch(ctx, w, r, tx, planID) {
+			return
+		}
+
+		if err := trashPlan(ctx, tx, planID); err != nil {
+			internalError(w, "delete failed", err)
+			return
+		}
+		version, err := touchPlan(ctx, tx, planID)
 		if err != nil {
-			http.Error(w, "delete failed: "+err.Error(), http.StatusInternalServerError)
+			internalError(w, "bump version failed", err)
 			return
 		}
 
-		if tag.RowsAffected() == 0 {
-			http.Error(w, "not found", http.StatusNotFound)
+		if err := tx.Commit(ctx); err != nil {
+			internalError(w, "commit failed", err)
 			return
 		}
 
+		publishPlanEvent(ctx, db, hub, realtime.Event{
+			Type: "plan.deleted", PlanID: planID, Version: version, ActorID: uid.String(),
+		})
+
 		w.Header().Set("Content-Type", "application/json")
 		_ = json.NewEncoder(w).Encode(map[string]any{
 			"ok":      true,
 			"plan_id": planID,
+			"trashed": true,
 		})
 	}
 }
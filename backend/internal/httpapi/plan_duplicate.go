@@ -0,0 +1,156 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type DuplicatePlanRequest struct {
+	// FromFirstUndone drops the leading done days and restarts the copy
+	// at the first day that wasn't finished (renumbered from 1).
+	FromFirstUndone bool    `json:"from_first_undone,omitempty"`
+	DailyMinutes    *int    `json:"daily_minutes,omitempty"`
+	Title           *string `json:"title,omitempty"`
+}
+
+// handleDuplicatePlan copies a plan and its days into a new plan owned by
+// the caller, with every day reset to not done. The copy links back to
+// the original through source_plan_id.
+func handleDuplicatePlan(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if db == nil {
+			httpError(w, "db not connected", http.StatusServiceUnavailable)
+			return
+		}
+		uid, ok := userIDFromCtx(r.Context())
+		if !ok {
+			httpError(w, "missing user", http.StatusUnauthorized)
+			return
+		}
+
+		planID := chi.URLParam(r, "id")
+		if planID == "" {
+			httpError(w, "missing id", http.StatusBadRequest)
+			return
+		}
+
+		var req DuplicatePlanRequest
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				httpError(w, "invalid json body", http.StatusBadRequest)
+				return
+			}
+		}
+		if req.DailyMinutes != nil && (*req.DailyMinutes <= 0 || *req.DailyMinutes > 24*60) {
+			httpError(w, "invalid daily_minutes", http.StatusBadRequest)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+
+		if _, ok := requirePlanRole(ctx, w, db, planID, uid, roleViewer); !ok {
+			return
+		}
+
+		var src PlanDetailResponse
+		err := db.QueryRow(ctx, `
+			select id, title, days, daily_minutes, coalesce(goal_type, ''), created_at
+			from public.plans where id = $1
+		`, planID).Scan(&src.ID, &src.Title, &src.Days, &src.DailyMinutes, &src.GoalType, &src.CreatedAt)
+		if err != nil {
+			httpError(w, "plan not found", http.StatusNotFound)
+			return
+		}
+
+		days, err := loadPlanDays(ctx, db, planID)
+		if err != nil {
+			internalError(w, "query plan_days failed", err)
+			return
+		}
+
+		if req.FromFirstUndone {
+			start := len(days)
+			for i, d := range days {
+				if !d.IsDone {
+					start = i
+					break
+				}
+			}
+			days = days[start:]
+		}
+		if len(days) == 0 {
+			httpError(w, "no undone days to restart", http.StatusBadRequest)
+			return
+		}
+
+		dailyMinutes := src.DailyMinutes
+		if req.DailyMinutes != nil {
+			dailyMinutes = *req.DailyMinutes
+		}
+		title := src.Title
+		if req.Title != nil && strings.TrimSpace(*req.Title) != "" {
+			title = strings.TrimSpace(*req.Title)
+		}
+
+		items := make([]PlanDay, 0, len(days))
+		for i, d := range days {
+			steps := d.Steps
+			if dailyMinutes != src.DailyMinutes {
+				steps = rebalanceSteps(steps, dailyMinutes)
+			}
+			if steps == nil {
+				steps = []PlanDayStep{}
+			}
+			items = append(items, PlanDay{
+				DayNumber: i + 1,
+				Focus:     d.Focus,
+				Steps:     steps,
+			})
+		}
+
+		tx, err := db.Begin(ctx)
+		if err != nil {
+			internalError(w, "begin tx failed", err)
+			return
+		}
+		defer func() { _ = tx.Rollback(ctx) }()
+
+		newID, createdAt, err := insertPlan(ctx, tx, uid, newPlan{
+			Title:        title,
+			Days:         len(items),
+			DailyMinutes: dailyMinutes,
+			GoalType:     src.GoalType,
+			SourcePlanID: &src.ID,
+			Items:        items,
+		})
+		if err != nil {
+			internalError(w, "duplicate failed", err)
+			return
+		}
+		if err := tx.Commit(ctx); err != nil {
+			internalError(w, "commit failed", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(PlanDetailResponse{
+			ID:           newID,
+			Title:        title,
+			Days:         len(items),
+			DailyMinutes: dailyMinutes,
+			GoalType:     src.GoalType,
+			SourcePlanID: &src.ID,
+			CreatedAt:    createdAt,
+			Role:         string(roleOwner),
+			Items:        items,
+		})
+	}
+}
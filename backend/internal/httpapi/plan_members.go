@@ -0,0 +1,532 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"sliceapp-backend/internal/realtime"
+)
+
+type PlanMember struct {
+	UserID    string    `json:"user_id"`
+	Role      string    `json:"role"`
+	JoinedAt  time.Time `json:"joined_at"`
+	DoneDays  []int     `json:"done_days"`
+	DaysDone  int       `json:"days_done"`
+	IsCurrent bool      `json:"is_current,omitempty"`
+}
+
+type StepClaim struct {
+	DayNumber int       `json:"day_number"`
+	StepIndex int       `json:"step_index"`
+	UserID    string    `json:"user_id"`
+	ClaimedAt time.Time `json:"claimed_at"`
+}
+
+type PlanTeamResponse struct {
+	PlanID  string       `json:"plan_id"`
+	Members []PlanMember `json:"members"`
+	Claims  []StepClaim  `json:"claims"`
+}
+
+type AddMemberRequest struct {
+	UserID string `json:"user_id"`
+	Role   string `json:"role"` // editor | viewer
+}
+
+type UpdateMemberRequest struct {
+	Role string `json:"role"`
+}
+
+type MemberCompletionRequest struct {
+	IsDone *bool `json:"is_done"`
+}
+
+// parseMemberRole accepts the roles an owner can hand out.
+// Ownership itself is not transferable through these endpoints.
+func parseMemberRole(s string) (planRole, bool) {
+	switch planRole(s) {
+	case roleEditor, roleViewer:
+		return planRole(s), true
+	}
+	return roleNone, false
+}
+
+// parseDayParam reads the {day} URL param with the same bounds as the day PATCH.
+func parseDayParam(r *http.Request) (int, bool) {
+	n, err := strconv.Atoi(chi.URLParam(r, "day"))
+	if err != nil || n <= 0 || n > maxPlanDays {
+		return 0, false
+	}
+	return n, true
+}
+
+func handleGetPlanTeam(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if db == nil {
+			httpError(w, "db not connected", http.StatusServiceUnavailable)
+			return
+		}
+		uid, ok := userIDFromCtx(r.Context())
+		if !ok {
+			httpError(w, "missing user", http.StatusUnauthorized)
+			return
+		}
+
+		planID := chi.URLParam(r, "id")
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+
+		if _, ok := requirePlanRole(ctx, w, db, planID, uid, roleViewer); !ok {
+			return
+		}
+
+		rows, err := db.Query(ctx, `
+			select m.user_id, m.role, m.created_at,
+			       coalesce(array_agg(md.day_number order by md.day_number)
+			                filter (where md.is_done), '{}')
+			from public.plan_members m
+			left join public.plan_member_days md
+			  on md.plan_id = m.plan_id and md.user_id = m.user_id
+			where m.plan_id = $1
+			group by m.user_id, m.role, m.created_at
+			order by m.created_at asc
+		`, planID)
+		if err != nil {
+			internalError(w, "query members failed", err)
+			return
+		}
+		defer rows.Close()
+
+		resp := PlanTeamResponse{PlanID: planID, Members: make([]PlanMember, 0), Claims: make([]StepClaim, 0)}
+		for rows.Next() {
+			var m PlanMember
+			var doneDays []int32
+			if err := rows.Scan(&m.UserID, &m.Role, &m.JoinedAt, &doneDays); err != nil {
+				internalError(w, "scan failed", err)
+				return
+			}
+			m.DoneDays = make([]int, 0, len(doneDays))
+			for _, d := range doneDays {
+				m.DoneDays = append(m.DoneDays, int(d))
+			}
+			m.DaysDone = len(m.DoneDays)
+			m.IsCurrent = m.UserID == uid.String()
+			resp.Members = append(resp.Members, m)
+		}
+		rows.Close()
+
+		crows, err := db.Query(ctx, `
+			select day_number, step_index, user_id, claimed_at
+			from public.plan_step_claims
+			where plan_id = $1
+			order by day_number, step_index
+		`, planID)
+		if err != nil {
+			internalError(w, "query claims failed", err)
+			return
+		}
+		defer crows.Close()
+
+		for crows.Next() {
+			var c StepClaim
+			if err := crows.Scan(&c.DayNumber, &c.StepIndex, &c.UserID, &c.ClaimedAt); err != nil {
+				internalError(w, "scan failed", err)
+				return
+			}
+			resp.Claims = append(resp.Claims, c)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(resp)
+	}
+}
+
+func handleAddPlanMember(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if db == nil {
+			httpError(w, "db not connected", http.StatusServiceUnavailable)
+			return
+		}
+		uid, ok := userIDFromCtx(r.Context())
+		if !ok {
+			httpError(w, "missing user", http.StatusUnauthorized)
+			return
+		}
+
+		planID := chi.URLParam(r, "id")
+
+		var req AddMemberRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			httpError(w, "invalid json body", http.StatusBadRequest)
+			return
+		}
+		memberID, err := uuid.Parse(req.UserID)
+		if err != nil {
+			httpError(w, "invalid user_id", http.StatusBadRequest)
+			return
+		}
+		role, ok := parseMemberRole(req.Role)
+		if !ok {
+			httpError(w, "role must be editor or viewer", http.StatusBadRequest)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 8*time.Second)
+		defer cancel()
+
+		if _, ok := requirePlanRole(ctx, w, db, planID, uid, roleOwner); !ok {
+			return
+		}
+
+		var m PlanMember
+		err = db.QueryRow(ctx, `
+			insert into public.plan_members (plan_id, user_id, role)
+			select $1, u.id, $3 from public.users u where u.id = $2
+			returning user_id, role, created_at
+		`, planID, memberID, string(role)).Scan(&m.UserID, &m.Role, &m.JoinedAt)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				httpError(w, "user not found", http.StatusNotFound)
+				return
+			}
+			if isUniqueViolation(err) {
+				httpError(w, "already a member", http.StatusConflict)
+				return
+			}
+			internalError(w, "add member failed", err)
+			return
+		}
+		m.DoneDays = []int{}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(m)
+	}
+}
+
+func handleUpdatePlanMember(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if db == nil {
+			httpError(w, "db not connected", http.StatusServiceUnavailable)
+			return
+		}
+		uid, ok := userIDFromCtx(r.Context())
+		if !ok {
+			httpError(w, "missing user", http.StatusUnauthorized)
+			return
+		}
+
+		planID := chi.URLParam(r, "id")
+		memberID, err := uuid.Parse(chi.URLParam(r, "userId"))
+		if err != nil {
+			httpError(w, "invalid user id", http.StatusBadRequest)
+			return
+		}
+
+		var req UpdateMemberRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			httpError(w, "invalid json body", http.StatusBadRequest)
+			return
+		}
+		role, ok := parseMemberRole(req.Role)
+		if !ok {
+			httpError(w, "role must be editor or viewer", http.StatusBadRequest)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 8*time.Second)
+		defer cancel()
+
+		if _, ok := requirePlanRole(ctx, w, db, planID, uid, roleOwner); !ok {
+			return
+		}
+
+		tag, err := db.Exec(ctx, `
+			update public.plan_members
+			set role = $3
+			where plan_id = $1 and user_id = $2 and role <> 'owner'
+		`, planID, memberID, string(role))
+		if err != nil {
+			internalError(w, "update member failed", err)
+			return
+		}
+		if tag.RowsAffected() == 0 {
+			httpError(w, "member not found", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"ok":      true,
+			"plan_id": planID,
+			"user_id": memberID.String(),
+			"role":    role,
+		})
+	}
+}
+
+// handleRemovePlanMember lets the owner remove anyone but themselves,
+// and lets any other member leave.
+func handleRemovePlanMember(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if db == nil {
+			httpError(w, "db not connected", http.StatusServiceUnavailable)
+			return
+		}
+		uid, ok := userIDFromCtx(r.Context())
+		if !ok {
+			httpError(w, "missing user", http.StatusUnauthorized)
+			return
+		}
+
+		planID := chi.URLParam(r, "id")
+		memberID, err := uuid.Parse(chi.URLParam(r, "userId"))
+		if err != nil {
+			httpError(w, "invalid user id", http.StatusBadRequest)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 8*time.Second)
+		defer cancel()
+
+		min := roleOwner
+		if memberID == uid {
+			min = roleViewer
+		}
+		if _, ok := requirePlanRole(ctx, w, db, planID, uid, min); !ok {
+			return
+		}
+
+		tag, err := db.Exec(ctx, `
+			delete from public.plan_members
+			where plan_id = $1 and user_id = $2 and role <> 'owner'
+		`, planID, memberID)
+		if err != nil {
+			internalError(w, "remove member failed", err)
+			return
+		}
+		if tag.RowsAffected() == 0 {
+			httpError(w, "member not found", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"ok":      true,
+			"plan_id": planID,
+			"user_id": memberID.String(),
+		})
+	}
+}
+
+// handleClaimStep assigns one step of a day to the current member.
+// A step already claimed by someone else returns 409.
+func handleClaimStep(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if db == nil {
+			httpError(w, "db not connected", http.StatusServiceUnavailable)
+			return
+		}
+		uid, ok := userIDFromCtx(r.Context())
+		if !ok {
+			httpError(w, "missing user", http.StatusUnauthorized)
+			return
+		}
+
+		planID := chi.URLParam(r, "id")
+		dayNumber, ok := parseDayParam(r)
+		if !ok {
+			httpError(w, "invalid day_number", http.StatusBadRequest)
+			return
+		}
+		stepIndex, err := strconv.Atoi(chi.URLParam(r, "step"))
+		if err != nil || stepIndex < 0 {
+			httpError(w, "invalid step index", http.StatusBadRequest)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 8*time.Second)
+		defer cancel()
+
+		if _, ok := requirePlanRole(ctx, w, db, planID, uid, roleEditor); !ok {
+			return
+		}
+
+		var c StepClaim
+		err = db.QueryRow(ctx, `
+			insert into public.plan_step_claims (plan_id, day_number, step_index, user_id)
+			select d.plan_id, d.day_number, $3, $4
+			from public.plan_days d
+			where d.plan_id = $1 and d.day_number = $2
+			  and $3 < jsonb_array_length(d.steps)
+			on conflict (plan_id, day_number, step_index) do update
+			  set claimed_at = now()
+			  where plan_step_claims.user_id = excluded.user_id
+			returning day_number, step_index, user_id, claimed_at
+		`, planID, dayNumber, stepIndex, uid).Scan(&c.DayNumber, &c.StepIndex, &c.UserID, &c.ClaimedAt)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				// Either the step doesn't exist or someone else holds it.
+				var exists bool
+				_ = db.QueryRow(ctx, `
+					select exists (
+						select 1 from public.plan_step_claims
+						where plan_id = $1 and day_number = $2 and step_index = $3
+					)
+				`, planID, dayNumber, stepIndex).Scan(&exists)
+				if exists {
+					httpError(w, "step already claimed", http.StatusConflict)
+					return
+				}
+				httpError(w, "step not found", http.StatusNotFound)
+				return
+			}
+			internalError(w, "claim failed", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(c)
+	}
+}
+
+// handleUnclaimStep releases a claim. The claimer or the owner may release.
+func handleUnclaimStep(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if db == nil {
+			httpError(w, "db not connected", http.StatusServiceUnavailable)
+			return
+		}
+		uid, ok := userIDFromCtx(r.Context())
+		if !ok {
+			httpError(w, "missing user", http.StatusUnauthorized)
+			return
+		}
+
+		planID := chi.URLParam(r, "id")
+		dayNumber, ok := parseDayParam(r)
+		if !ok {
+			httpError(w, "invalid day_number", http.StatusBadRequest)
+			return
+		}
+		stepIndex, err := strconv.Atoi(chi.URLParam(r, "step"))
+		if err != nil || stepIndex < 0 {
+			httpError(w, "invalid step index", http.StatusBadRequest)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 8*time.Second)
+		defer cancel()
+
+		role, ok := requirePlanRole(ctx, w, db, planID, uid, roleEditor)
+		if !ok {
+			return
+		}
+
+		tag, err := db.Exec(ctx, `
+			delete from public.plan_step_claims
+			where plan_id = $1 and day_number = $2 and step_index = $3
+			  and (user_id = $4 or $5)
+		`, planID, dayNumber, stepIndex, uid, role == roleOwner)
+		if err != nil {
+			internalError(w, "unclaim failed", err)
+			return
+		}
+		if tag.RowsAffected() == 0 {
+			httpError(w, "claim not found", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"ok":         true,
+			"plan_id":    planID,
+			"day_number": dayNumber,
+			"step_index": stepIndex,
+		})
+	}
+}
+
+// handleSetMemberCompletion records the current member's own completion of a
+// day. The shared plan_days.is_done flag stays the team-wide "day is done".
+func handleSetMemberCompletion(db *pgxpool.Pool, hub *realtime.Broker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if db == nil {
+			httpError(w, "db not connected", http.StatusServiceUnavailable)
+			return
+		}
+		uid, ok := userIDFromCtx(r.Context())
+		if !ok {
+			httpError(w, "missing user", http.StatusUnauthorized)
+			return
+		}
+
+		planID := chi.URLParam(r, "id")
+		dayNumber, ok := parseDayParam(r)
+		if !ok {
+			httpError(w, "invalid day_number", http.StatusBadRequest)
+			return
+		}
+
+		var req MemberCompletionRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			httpError(w, "invalid json body", http.StatusBadRequest)
+			return
+		}
+		if req.IsDone == nil {
+			httpError(w, "missing is_done", http.StatusBadRequest)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 8*time.Second)
+		defer cancel()
+
+		if _, ok := requirePlanRole(ctx, w, db, planID, uid, roleEditor); !ok {
+			return
+		}
+
+		tag, err := db.Exec(ctx, `
+			insert into public.plan_member_days (plan_id, day_number, user_id, is_done)
+			select d.plan_id, d.day_number, $3, $4
+			from public.plan_days d
+			where d.plan_id = $1 and d.day_number = $2
+			on conflict (plan_id, day_number, user_id) do update
+			  set is_done = excluded.is_done, updated_at = now()
+		`, planID, dayNumber, uid, *req.IsDone)
+		if err != nil {
+			internalError(w, "update failed", err)
+			return
+		}
+		if tag.RowsAffected() == 0 {
+			httpError(w, "plan_day not found", http.StatusNotFound)
+			return
+		}
+
+		if *req.IsDone {
+			recordDayDoneEvent(ctx, db, uid, planID, dayNumber)
+		}
+		publishPlanEvent(ctx, db, hub, realtime.Event{
+			Type: "completion.updated", PlanID: planID, DayNumber: &dayNumber,
+			ActorID: uid.String(),
+		})
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"ok":         true,
+			"plan_id":    planID,
+			"day_number": dayNumber,
+			"user_id":    uid.String(),
+			"is_done":    *req.IsDone,
+		})
+	}
+}
@@ -0,0 +1,213 @@
+package httpapi
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+type CreateShareRequest struct {
+	// ExpiresInHours is optional; 0 / missing means the link never expires.
+	ExpiresInHours int  `json:"expires_in_hours,omitempty"`
+	HideNotes      bool `json:"hide_notes,omitempty"`
+}
+
+type ShareResponse struct {
+	PlanID    string     `json:"plan_id"`
+	Token     string     `json:"token"`
+	HideNotes bool       `json:"hide_notes"`
+	ExpiresAt *time.Time `json:"expires_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// newShareToken returns 32 random bytes as URL-safe base64 (43 chars).
+func newShareToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func handleCreateShare(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if db == nil {
+			httpError(w, "db not connected", http.StatusServiceUnavailable)
+			return
+		}
+		uid, ok := userIDFromCtx(r.Context())
+		if !ok {
+			httpError(w, "missing user", http.StatusUnauthorized)
+			return
+		}
+
+		planID := chi.URLParam(r, "id")
+		if planID == "" {
+			httpError(w, "missing id", http.StatusBadRequest)
+			return
+		}
+
+		// Body is optional: no body = never expires, notes visible.
+		var req CreateShareRequest
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				httpError(w, "invalid json body", http.StatusBadRequest)
+				return
+			}
+		}
+		if req.ExpiresInHours < 0 || req.ExpiresInHours > 24*365 {
+			httpError(w, "invalid expires_in_hours", http.StatusBadRequest)
+			return
+		}
+
+		var expiresAt *time.Time
+		if req.ExpiresInHours > 0 {
+			t := time.Now().Add(time.Duration(req.ExpiresInHours) * time.Hour)
+			expiresAt = &t
+		}
+
+		token, err := newShareToken()
+		if err != nil {
+			internalError(w, "token generation failed", err)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 8*time.Second)
+		defer cancel()
+
+		if _, ok := requirePlanRole(ctx, w, db, planID, uid, roleOwner); !ok {
+			return
+		}
+
+		// Re-sharing rotates the token.
+		var resp ShareResponse
+		err = db.QueryRow(ctx, `
+			insert into public.plan_shares (plan_id, token, hide_notes, expires_at)
+			values ($1, $2, $3, $4)
+			on conflict (plan_id) do update
+			  set token = excluded.token,
+			      hide_notes = excluded.hide_notes,
+			      expires_at = excluded.expires_at,
+			      created_at = now()
+			returning plan_id, token, hide_notes, expires_at, created_at
+		`, planID, token, req.HideNotes, expiresAt).Scan(
+			&resp.PlanID, &resp.Token, &resp.HideNotes, &resp.ExpiresAt, &resp.CreatedAt,
+		)
+		if err != nil {
+			internalError(w, "create share failed", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(resp)
+	}
+}
+
+func handleDeleteShare(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if db == nil {
+			httpError(w, "db not connected", http.StatusServiceUnavailable)
+			return
+		}
+		uid, ok := userIDFromCtx(r.Context())
+		if !ok {
+			httpError(w, "missing user", http.StatusUnauthorized)
+			return
+		}
+
+		planID := chi.URLParam(r, "id")
+		if planID == "" {
+			httpError(w, "missing id", http.StatusBadRequest)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 8*time.Second)
+		defer cancel()
+
+		if _, ok := requirePlanRole(ctx, w, db, planID, uid, roleOwner); !ok {
+			return
+		}
+
+		tag, err := db.Exec(ctx, `
+			delete from public.plan_shares
+			where plan_id = $1
+		`, planID)
+		if err != nil {
+			internalError(w, "delete share failed", err)
+			return
+		}
+		if tag.RowsAffected() == 0 {
+			httpError(w, "share not found", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"ok":      true,
+			"plan_id": planID,
+		})
+	}
+}
+
+// handleGetShared serves a plan to anyone holding a valid token.
+// The response never carries the owner's user id; with hide_notes the
+// free-text parts (day focus, step deliverables) are stripped as well.
+func handleGetShared(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if db == nil {
+			httpError(w, "db not connected", http.StatusServiceUnavailable)
+			return
+		}
+
+		token := chi.URLParam(r, "token")
+		if token == "" {
+			httpError(w, "missing token", http.StatusBadRequest)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+
+		var resp PlanDetailResponse
+		var hideNotes bool
+		err := db.QueryRow(ctx, `
+			select p.id, p.title, p.days, p.daily_minutes, p.created_at, s.hide_notes
+			from public.plan_shares s
+			join public.plans p on p.id = s.plan_id
+			where s.token = $1
+			  and p.deleted_at is null
+			  and (s.expires_at is null or s.expires_at > now())
+		`, token).Scan(&resp.ID, &resp.Title, &resp.Days, &resp.DailyMinutes, &resp.CreatedAt, &hideNotes)
+		if err != nil {
+			// Unknown, revoked and expired tokens all look the same.
+			httpError(w, "share not found", http.StatusNotFound)
+			return
+		}
+
+		items, err := loadPlanDays(ctx, db, resp.ID)
+		if err != nil {
+			internalError(w, "query plan_days failed", err)
+			return
+		}
+
+		if hideNotes {
+			for i := range items {
+				items[i].Focus = ""
+				for j := range items[i].Steps {
+					items[i].Steps[j].Deliverable = ""
+				}
+			}
+		}
+		resp.Items = items
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		_ = json.NewEncoder(w).Encode(resp)
+	}
+}
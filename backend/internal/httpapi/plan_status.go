@@ -0,0 +1,283 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"sliceapp-backend/internal/realtime"
+)
+
+const (
+	statusActive    = "active"
+	statusPaused    = "paused"
+	statusArchived  = "archived"
+	statusCompleted = "completed"
+)
+
+var planStatuses = map[string]bool{
+	statusActive:    true,
+	statusPaused:    true,
+	statusArchived:  true,
+	statusCompleted: true,
+}
+
+type SetPlanStatusRequest struct {
+	Status string `json:"status"`
+}
+
+type PlanProgress struct {
+	PlanID   string `json:"plan_id"`
+	Status   string `json:"status"`
+	Days     int    `json:"days"`
+	DoneDays int    `json:"done_days"`
+	ClockDay int    `json:"clock_day"`
+	// TodayDay is the plan day due on ClockDay once skips are accounted for.
+	TodayDay    int        `json:"today_day"`
+	Missed      []int      `json:"missed"`
+	BadDays     []int      `json:"bad_days"`
+	SkippedDays []int      `json:"skipped_days"`
+	Streak      int        `json:"streak"`
+	PausedAt    *time.Time `json:"paused_at,omitempty"`
+	PausedFor   int64      `json:"paused_seconds"`
+}
+
+// setPlanStatus moves planID to status and keeps the pause bookkeeping
+// straight: paused and archived freeze the day clock, leaving them adds
+// the frozen time to paused_seconds.
+func setPlanStatus(ctx context.Context, q querier, planID, status string) error {
+	_, err := q.Exec(ctx, `
+		update public.plans set
+		  paused_seconds = paused_seconds + case
+		    when paused_at is not null and $2 not in ('paused', 'archived')
+		    then extract(epoch from now() - paused_at)::bigint else 0 end,
+		  paused_at = case
+		    when $2 in ('paused', 'archived') then coalesce(paused_at, now())
+		    else null end,
+		  completed_at = case
+		    when $2 = 'completed' then coalesce(completed_at, now())
+		    else null end,
+		  status = $2
+		where id = $1
+	`, planID, status)
+	return err
+}
+
+// refreshPlanCompletion completes an active or paused plan once every day
+// is done, and reopens a completed one when a day is unticked. Archived
+// plans are left alone. It returns the resulting status.
+func refreshPlanCompletion(ctx context.Context, q querier, planID string) (string, error) {
+	var status string
+	var allDone bool
+	err := q.QueryRow(ctx, `
+		select p.status,
+		       exists (select 1 from public.plan_days d where d.plan_id = p.id)
+		       and not exists (select 1 from public.plan_days d where d.plan_id = p.id and not d.is_done)
+		from public.plans p
+		where p.id = $1
+	`, planID).Scan(&status, &allDone)
+	if err != nil {
+		return "", err
+	}
+
+	next := status
+	switch {
+	case allDone && (status == statusActive || status == statusPaused):
+		next = statusCompleted
+	case !allDone && status == statusCompleted:
+		next = statusActive
+	}
+	if next == status {
+		return status, nil
+	}
+	return next, setPlanStatus(ctx, q, planID, next)
+}
+
+// planClockDay is the day the plan is on by the calendar, not counting
+// time spent paused. Day 1 starts at created_at.
+func planClockDay(createdAt time.Time, pausedSeconds int64, pausedAt *time.Time, now time.Time, days int) int {
+	end := now
+	if pausedAt != nil {
+		end = *pausedAt
+	}
+	elapsed := end.Sub(createdAt) - time.Duration(pausedSeconds)*time.Second
+	day := int(elapsed/(24*time.Hour)) + 1
+	return clampInt(day, 1, max(days, 1))
+}
+
+// handleSetPlanStatus: PUT /plans/{id}/status. Owner only.
+func handleSetPlanStatus(db *pgxpool.Pool, hub *realtime.Broker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if db == nil {
+			httpError(w, "db not connected", http.StatusServiceUnavailable)
+			return
+		}
+		uid, ok := userIDFromCtx(r.Context())
+		if !ok {
+			httpError(w, "missing user", http.StatusUnauthorized)
+			return
+		}
+
+		planID := chi.URLParam(r, "id")
+
+		var req SetPlanStatusRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			httpError(w, "invalid json body", http.StatusBadRequest)
+			return
+		}
+		if !planStatuses[req.Status] {
+			httpError(w, "status must be active, paused, archived or completed", http.StatusBadRequest)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 8*time.Second)
+		defer cancel()
+
+		tx, err := db.Begin(ctx)
+		if err != nil {
+			internalError(w, "begin tx failed", err)
+			return
+		}
+		defer func() { _ = tx.Rollback(ctx) }()
+
+		if _, ok := requirePlanRole(ctx, w, tx, planID, uid, roleOwner); !ok {
+			return
+		}
+		if !checkIfMatch(ctx, w, r, tx, planID) {
+			return
+		}
+
+		if err := setPlanStatus(ctx, tx, planID, req.Status); err != nil {
+			internalError(w, "update failed", err)
+			return
+		}
+		version, err := touchPlan(ctx, tx, planID)
+		if err != nil {
+			internalError(w, "bump version failed", err)
+			return
+		}
+
+		if err := tx.Commit(ctx); err != nil {
+			internalError(w, "commit failed", err)
+			return
+		}
+
+		publishPlanEvent(ctx, db, hub, realtime.Event{
+			Type: "plan.updated", PlanID: planID, Version: version, ActorID: uid.String(),
+		})
+
+		w.Header().Set("ETag", planETag(version))
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"ok":      true,
+			"plan_id": planID,
+			"status":  req.Status,
+			"version": version,
+		})
+	}
+}
+
+// handleGetPlanProgress: GET /plans/{id}/progress reports the day clock,
+// missed days and the current streak. Paused time doesn't advance the
+// clock, so days that would have fallen in a pause are not misses.
+func handleGetPlanProgress(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if db == nil {
+			httpError(w, "db not connected", http.StatusServiceUnavailable)
+			return
+		}
+		uid, ok := userIDFromCtx(r.Context())
+		if !ok {
+			httpError(w, "missing user", http.StatusUnauthorized)
+			return
+		}
+
+		planID := chi.URLParam(r, "id")
+
+		ctx, cancel := context.WithTimeout(r.Context(), 8*time.Second)
+		defer cancel()
+
+		if _, ok := requirePlanRole(ctx, w, db, planID, uid, roleViewer); !ok {
+			return
+		}
+
+		resp := PlanProgress{PlanID: planID, Missed: []int{}, BadDays: []int{}, SkippedDays: []int{}}
+		var createdAt time.Time
+		err := db.QueryRow(ctx, `
+			select status, days, created_at, paused_seconds, paused_at
+			from public.plans where id = $1
+		`, planID).Scan(&resp.Status, &resp.Days, &createdAt, &resp.PausedFor, &resp.PausedAt)
+		if err != nil {
+			internalError(w, "query failed", err)
+			return
+		}
+
+		rows, err := db.Query(ctx, `
+			select day_number, status, skip_count
+			from public.plan_days where plan_id = $1
+			order by day_number
+		`, planID)
+		if err != nil {
+			internalError(w, "query failed", err)
+			return
+		}
+		var days []dayRow
+		skips := 0
+		for rows.Next() {
+			var d dayRow
+			if err := rows.Scan(&d.DayNumber, &d.Status, &d.SkipCount); err != nil {
+				rows.Close()
+				internalError(w, "scan failed", err)
+				return
+			}
+			skips += d.SkipCount
+			days = append(days, d)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			internalError(w, "query failed", err)
+			return
+		}
+
+		// Each skip makes the plan one calendar day longer.
+		resp.ClockDay = planClockDay(createdAt, resp.PausedFor, resp.PausedAt, time.Now(), resp.Days+skips)
+		if resp.Status == statusCompleted {
+			resp.ClockDay = resp.Days + skips
+		}
+
+		sched := scheduleDays(days)
+		resp.TodayDay = todayDay(sched, resp.ClockDay)
+		done := make(map[int]bool, len(sched))
+		for _, d := range sched {
+			switch {
+			case dayCountsDone(d.Status):
+				resp.DoneDays++
+				done[d.DayNumber] = true
+				if d.Status == dayBadDay {
+					resp.BadDays = append(resp.BadDays, d.DayNumber)
+				}
+			case d.Slot < resp.ClockDay:
+				resp.Missed = append(resp.Missed, d.DayNumber)
+			}
+			if d.Status == daySkipped {
+				resp.SkippedDays = append(resp.SkippedDays, d.DayNumber)
+			}
+		}
+
+		// Today doesn't break the streak until it is over.
+		d := resp.TodayDay
+		if !done[d] {
+			d--
+		}
+		for ; d >= 1 && done[d]; d-- {
+			resp.Streak++
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(resp)
+	}
+}
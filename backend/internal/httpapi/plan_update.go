@@ -0,0 +1,249 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"sliceapp-backend/internal/ai"
+	"sliceapp-backend/internal/config"
+	"sliceapp-backend/internal/realtime"
+)
+
+// The shrink prompt carries every undone day; past this it gets too long
+// to be reliable.
+const maxShrinkDays = 14
+
+type UpdatePlanRequest struct {
+	Title        *string `json:"title"`
+	DailyMinutes *int    `json:"daily_minutes"`
+	// Shrink asks the AI to cut undone days' content down to the new
+	// daily_minutes, not just their minutes.
+	Shrink bool `json:"shrink"`
+}
+
+// shrinkUndoneDays asks the splitter to rewrite the plan's undone days
+// for dailyMinutes. It runs before the write transaction, so it also
+// returns the plan version the days were read at; the caller applies the
+// result only if the plan is still at that version.
+func shrinkUndoneDays(ctx context.Context, db *pgxpool.Pool, cfg config.Config, uid uuid.UUID, planID string, dailyMinutes int) (map[int]PlanDay, int, error) {
+	detail, err := loadPlanDetail(ctx, db, planID)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	var undone []ai.PlanDay
+	for _, it := range detail.Items {
+		if !it.IsDone && len(it.Steps) > 0 {
+			undone = append(undone, *aiDayFromPlanDay(it))
+		}
+	}
+	if len(undone) > maxShrinkDays {
+		return nil, 0, &dayOpError{http.StatusBadRequest, "too many undone days to shrink at once"}
+	}
+
+	client := ai.NewClient(cfg.OpenAIKey, cfg.OpenAIModel)
+	out, err := client.ShrinkDays(ctx, detail.Title, dailyMinutes, undone)
+	recordAIUsage(ctx, db, cfg, uid, planID, aiOpShrinkDays, client)
+	if err != nil {
+		return nil, 0, err
+	}
+	byDay := make(map[int]PlanDay, len(out))
+	for _, d := range out {
+		byDay[d.DayNumber] = planDayFromAI(d)
+	}
+	return byDay, detail.Version, nil
+}
+
+// handleUpdatePlan: PATCH /plans/{id} changes the title and/or
+// daily_minutes. A new daily_minutes rebalances every undone day with the
+// splitter's budget rule; done days keep the minutes they were done with.
+func handleUpdatePlan(db *pgxpool.Pool, cfg config.Config, hub *realtime.Broker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if db == nil {
+			httpError(w, "db not connected", http.StatusServiceUnavailable)
+			return
+		}
+		uid, ok := userIDFromCtx(r.Context())
+		if !ok {
+			httpError(w, "missing user", http.StatusUnauthorized)
+			return
+		}
+
+		planID := chi.URLParam(r, "id")
+
+		var req UpdatePlanRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			httpError(w, "invalid json body", http.StatusBadRequest)
+			return
+		}
+		if req.Title == nil && req.DailyMinutes == nil {
+			httpError(w, "nothing to update", http.StatusBadRequest)
+			return
+		}
+		if req.Title != nil {
+			t := strings.TrimSpace(*req.Title)
+			if t == "" {
+				httpError(w, "title must not be empty", http.StatusBadRequest)
+				return
+			}
+			req.Title = &t
+		}
+		if req.DailyMinutes != nil && (*req.DailyMinutes <= 0 || *req.DailyMinutes > 24*60) {
+			httpError(w, "invalid daily_minutes", http.StatusBadRequest)
+			return
+		}
+		if req.Shrink && req.DailyMinutes == nil {
+			httpError(w, "shrink needs daily_minutes", http.StatusBadRequest)
+			return
+		}
+
+		var shrunk map[int]PlanDay
+		var shrunkAt int
+		aiCfg := cfg
+		if req.Shrink {
+			aiCfg = budgetedAI(r.Context(), db, cfg)
+		}
+		if req.Shrink && !aiCfg.UseFakeAI {
+			ctx, cancel := context.WithTimeout(r.Context(), 40*time.Second)
+			defer cancel()
+
+			if _, ok := requirePlanRole(ctx, w, db, planID, uid, roleEditor); !ok {
+				return
+			}
+			if !takeAIQuota(ctx, w, db, aiCfg, uid) {
+				return
+			}
+			var err error
+			shrunk, shrunkAt, err = shrinkUndoneDays(ctx, db, aiCfg, uid, planID, *req.DailyMinutes)
+			if err != nil {
+				refundAIQuota(ctx, db, aiCfg, uid)
+				var opErr *dayOpError
+				if errors.As(err, &opErr) {
+					httpError(w, opErr.msg, opErr.status)
+					return
+				}
+				upstreamError(w, "ai generation failed", err)
+				return
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+
+		tx, err := db.Begin(ctx)
+		if err != nil {
+			internalError(w, "begin tx failed", err)
+			return
+		}
+		defer func() { _ = tx.Rollback(ctx) }()
+
+		role, ok := requirePlanRole(ctx, w, tx, planID, uid, roleEditor)
+		if !ok {
+			return
+		}
+		if !checkIfMatch(ctx, w, r, tx, planID) {
+			return
+		}
+		// The shrunk days were generated from the days as they were before
+		// the AI call. If anything was written since, applying them would
+		// silently undo that write.
+		if shrunk != nil {
+			version, err := lockPlanVersion(ctx, tx, planID)
+			if err != nil {
+				internalError(w, "load version failed", err)
+				return
+			}
+			if version != shrunkAt {
+				refundAIQuota(ctx, db, aiCfg, uid)
+				httpError(w, "plan changed while it was being shrunk; try again", http.StatusConflict)
+				return
+			}
+		}
+
+		before, err := snapshotPlan(ctx, tx, planID)
+		if err != nil {
+			internalError(w, "snapshot failed", err)
+			return
+		}
+
+		_, err = tx.Exec(ctx, `
+			update public.plans
+			set title = coalesce($2, title), daily_minutes = coalesce($3, daily_minutes)
+			where id = $1
+		`, planID, req.Title, req.DailyMinutes)
+		if err != nil {
+			internalError(w, "update failed", err)
+			return
+		}
+
+		if req.DailyMinutes != nil {
+			items, err := loadPlanDays(ctx, tx, planID)
+			if err != nil {
+				internalError(w, "load days failed", err)
+				return
+			}
+			for _, it := range items {
+				// Days whose steps don't parse are left as they are.
+				if it.IsDone || len(it.Steps) == 0 {
+					continue
+				}
+				focus, steps := it.Focus, it.Steps
+				if s, ok := shrunk[it.DayNumber]; ok {
+					focus, steps = s.Focus, s.Steps
+				}
+				stepsJSON, _ := json.Marshal(rebalanceSteps(steps, *req.DailyMinutes))
+				_, err := tx.Exec(ctx, `
+					update public.plan_days set focus = $3, steps = $4
+					where plan_id = $1 and day_number = $2
+				`, planID, it.DayNumber, focus, stepsJSON)
+				if err != nil {
+					internalError(w, "update failed", err)
+					return
+				}
+			}
+		}
+
+		after, err := snapshotPlan(ctx, tx, planID)
+		if err != nil {
+			internalError(w, "snapshot failed", err)
+			return
+		}
+		if err := recordRevision(ctx, tx, planID, nil, uid, "update_plan", before, after); err != nil {
+			internalError(w, "record revision failed", err)
+			return
+		}
+		version, err := touchPlan(ctx, tx, planID)
+		if err != nil {
+			internalError(w, "bump version failed", err)
+			return
+		}
+
+		resp, err := loadPlanDetail(ctx, tx, planID)
+		if err != nil {
+			internalError(w, "load plan failed", err)
+			return
+		}
+		resp.Role = string(role)
+
+		if err := tx.Commit(ctx); err != nil {
+			internalError(w, "commit failed", err)
+			return
+		}
+
+		publishPlanEvent(ctx, db, hub, realtime.Event{
+			Type: "plan.updated", PlanID: planID, Version: version, ActorID: uid.String(),
+		})
+
+		w.Header().Set("ETag", planETag(version))
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(resp)
+	}
+}
@@ -1,168 +1,308 @@
 package httpapi
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
+	"io"
+	"mime"
 	"net/http"
+	"slices"
 	"strconv"
+	"strings"
 	"time"
 
-	"github.com/jackc/pgx/v5"
-
 	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5/pgxpool"
+
+	"sliceapp-backend/internal/realtime"
 )
 
+const mergePatchType = "application/merge-patch+json"
+
+// UpdatePlanDayRequest documents the merge patch (RFC 7396) a day accepts.
+// A member that is sent replaces the stored value, a null resets it to its
+// default ("", [], false, pending), and a member left out is kept. Steps
+// are replaced as a whole, as merge patch does with arrays. When status is
+// sent it decides is_done, and is_done is ignored.
 type UpdatePlanDayRequest struct {
 	Focus  *string         `json:"focus,omitempty"`
-	Steps  json.RawMessage `json:"steps,omitempty"` // expecting JSON array
+	Steps  json.RawMessage `json:"steps,omitempty"` // array of PlanDayStep
 	IsDone *bool           `json:"is_done,omitempty"`
+	Status *string         `json:"status,omitempty"`
 }
 
-func handleUpdatePlanDay(db *pgxpool.Pool) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		if db == nil {
-			http.Error(w, "db not connected", http.StatusServiceUnavailable)
-			return
-		}
+type DayUpdateResult struct {
+	OK        bool   `json:"ok"`
+	PlanID    string `json:"plan_id"`
+	DayNumber int    `json:"day_number"`
+	IsDone    bool   `json:"is_done"`
+	DayStatus string `json:"day_status"`
+	Status    string `json:"status"`
+	Version   int    `json:"version"`
+}
 
-		planID := chi.URLParam(r, "id")
-		if planID == "" {
-			http.Error(w, "missing id", http.StatusBadRequest)
-			return
+// dayPatch is a decoded merge patch: one column per member sent, with
+// nulls already turned into the column's default.
+type dayPatch struct {
+	columns []string
+	args    []any
+}
+
+func (p *dayPatch) set(column string, v any) {
+	p.columns = append(p.columns, column)
+	p.args = append(p.args, v)
+}
+
+func (p *dayPatch) has(column string) bool {
+	for _, c := range p.columns {
+		if c == column {
+			return true
 		}
+	}
+	return false
+}
 
-		dayStr := chi.URLParam(r, "dayNumber")
-		dayNumber, err := strconv.Atoi(dayStr)
-		if err != nil || dayNumber <= 0 {
-			http.Error(w, "invalid dayNumber", http.StatusBadRequest)
-			return
+// dayPatchFields are the members a day patch may carry, in the order
+// they are checked.
+var dayPatchFields = []string{"focus", "steps", "is_done", "status"}
+
+var (
+	errDayPatchNotObject = errors.New("day patch is not a JSON object")
+	errDayPatchEmpty     = errors.New("day patch is empty")
+)
+
+// decodeDayPatch reads a merge patch for a day. Unknown members are
+// errors rather than ignored, so a typo doesn't look like a no-op.
+func decodeDayPatch(body []byte) (*dayPatch, []FieldError, error) {
+	var members map[string]json.RawMessage
+	if err := json.Unmarshal(body, &members); err != nil || members == nil {
+		return nil, nil, errDayPatchNotObject
+	}
+	p, errs := dayPatchFromMembers(members)
+	if len(errs) > 0 {
+		return nil, errs, nil
+	}
+	if len(p.columns) == 0 {
+		return nil, nil, errDayPatchEmpty
+	}
+	return p, nil, nil
+}
+
+// dayPatchFromMembers turns the members of a day patch into columns.
+func dayPatchFromMembers(members map[string]json.RawMessage) (*dayPatch, []FieldError) {
+	var errs []FieldError
+	unknown := make([]string, 0)
+	for name := range members {
+		if !slices.Contains(dayPatchFields, name) {
+			unknown = append(unknown, name)
 		}
+	}
+	slices.Sort(unknown)
+	for _, name := range unknown {
+		errs = append(errs, FieldError{Field: name, Message: "unknown or read-only field"})
+	}
 
-		var req UpdatePlanDayRequest
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "invalid json body", http.StatusBadRequest)
-			return
+	// Status wins: writing is_done next to an unchanged status would make
+	// the day_status trigger derive the status from is_done instead.
+	if _, ok := members["status"]; ok {
+		delete(members, "is_done")
+	}
+
+	var p dayPatch
+	isNull := func(raw json.RawMessage) bool { return bytes.Equal(bytes.TrimSpace(raw), []byte("null")) }
+	for _, name := range dayPatchFields {
+		raw, ok := members[name]
+		if !ok {
+			continue
 		}
+		switch name {
+		case "focus":
+			focus := ""
+			if !isNull(raw) && json.Unmarshal(raw, &focus) != nil {
+				errs = append(errs, FieldError{Field: name, Message: "must be a string"})
+				continue
+			}
+			p.set(name, focus)
+		case "steps":
+			steps := []PlanDayStep{}
+			if !isNull(raw) {
+				var stepErrs []FieldError
+				if steps, stepErrs = decodeSteps(raw); len(stepErrs) > 0 {
+					errs = append(errs, stepErrs...)
+					continue
+				}
+			}
+			stepsJSON, _ := json.Marshal(steps)
+			p.set(name, stepsJSON)
+		case "is_done":
+			isDone := false
+			if !isNull(raw) && json.Unmarshal(raw, &isDone) != nil {
+				errs = append(errs, FieldError{Field: name, Message: "must be a boolean"})
+				continue
+			}
+			p.set(name, isDone)
+		case "status":
+			status := dayPending
+			if !isNull(raw) && (json.Unmarshal(raw, &status) != nil || !dayStatuses[status]) {
+				errs = append(errs, FieldError{Field: name, Message: "must be pending, done, bad_day or skipped"})
+				continue
+			}
+			p.set(name, status)
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return &p, nil
+}
+
+// patchedDay is a day's done state after applyDayPatch.
+type patchedDay struct {
+	IsDone bool
+	Status string
+}
+
+// applyDayPatch writes patch to one day and records the change in the
+// plan's history under action. It returns nil, nil when the day doesn't
+// exist. The caller refreshes the plan's status and version.
+func applyDayPatch(ctx context.Context, q querier, planID string, dayNumber int, uid uuid.UUID, action string, patch *dayPatch) (*patchedDay, error) {
+	// Keep the previous content so a bad save can be reverted.
+	before, err := snapshotDay(ctx, q, planID, dayNumber)
+	if err != nil || before == nil {
+		return nil, err
+	}
+
+	args := []any{planID, dayNumber}
+	sets := make([]string, 0, len(patch.columns))
+	for i, c := range patch.columns {
+		args = append(args, patch.args[i])
+		sets = append(sets, fmt.Sprintf("%s = $%d", c, len(args)))
+	}
+	var out patchedDay
+	err = q.QueryRow(ctx, `
+		update public.plan_days set `+strings.Join(sets, ", ")+`
+		where plan_id = $1 and day_number = $2
+		returning is_done, status
+	`, args...).Scan(&out.IsDone, &out.Status)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := recordDayChange(ctx, q, planID, dayNumber, uid, action, before); err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
 
-		// If nothing provided, do nothing
-		if req.Focus == nil && req.Steps == nil && req.IsDone == nil {
-			http.Error(w, "nothing to update", http.StatusBadRequest)
+// handleUpdatePlanDay: PATCH /v1/plans/{id}/days/{day} applies a merge
+// patch to one day. Plain application/json bodies are read the same way,
+// which is what the unversioned route always accepted.
+func handleUpdatePlanDay(db *pgxpool.Pool, hub *realtime.Broker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if db == nil {
+			httpError(w, "db not connected", http.StatusServiceUnavailable)
 			return
 		}
 
-		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
-		defer cancel()
-
 		uid, ok := userIDFromCtx(r.Context())
 		if !ok {
-			http.Error(w, "missing user", http.StatusUnauthorized)
+			httpError(w, "missing user", http.StatusUnauthorized)
 			return
 		}
 
-		// Validate steps JSON if provided (must be array)
-		if req.Steps != nil {
-			var tmp []any
-			if err := json.Unmarshal(req.Steps, &tmp); err != nil {
-				http.Error(w, "steps must be a json array", http.StatusBadRequest)
+		planID := chi.URLParam(r, "id")
+		dayNumber, err := strconv.Atoi(chi.URLParam(r, "day"))
+		if err != nil || dayNumber <= 0 || dayNumber > 365 {
+			httpError(w, "invalid day_number", http.StatusBadRequest)
+			return
+		}
+
+		if ct := r.Header.Get("Content-Type"); ct != "" {
+			mt, _, _ := mime.ParseMediaType(ct)
+			if mt != mergePatchType && mt != "application/json" {
+				w.Header().Set("Accept-Patch", mergePatchType)
+				httpError(w, "content type must be "+mergePatchType, http.StatusUnsupportedMediaType)
 				return
 			}
 		}
 
-		// Build update dynamically (patch semantics)
-		// We'll use COALESCE style by passing current value when nil isn't updated.
-		// But to keep it simple, do 3 independent updates depending on fields.
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			httpError(w, "invalid body", http.StatusBadRequest)
+			return
+		}
+		patch, fieldErrs, err := decodeDayPatch(body)
+		if len(fieldErrs) > 0 {
+			writeValidationErrors(w, fieldErrs)
+			return
+		}
+		if errors.Is(err, errDayPatchEmpty) {
+			httpError(w, "nothing to update", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			httpError(w, "body must be a JSON object", http.StatusBadRequest)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
 
 		tx, err := db.Begin(ctx)
 		if err != nil {
-			http.Error(w, "begin tx failed", http.StatusInternalServerError)
+			internalError(w, "begin tx failed", err)
 			return
 		}
 		defer func() { _ = tx.Rollback(ctx) }()
 
-		// helper: run update with owner check and require at least 1 row
-		run := func(sql string, args ...any) error {
-			tag, err := tx.Exec(ctx, sql, args...)
-			if err != nil {
-				return err
-			}
-			if tag.RowsAffected() == 0 {
-				return pgx.ErrNoRows
-			}
-			return nil
-		}
-
-		if req.Focus != nil {
-			err = run(`
-		update public.plan_days d
-		set focus = $1
-		where d.plan_id = $2 and d.day_number = $3
-		  and exists (
-			select 1 from public.plans p
-			where p.id = d.plan_id and p.user_id = $4
-		  )
-	`, *req.Focus, planID, dayNumber, uid)
-			if err != nil {
-				if errors.Is(err, pgx.ErrNoRows) {
-					http.Error(w, "not found", http.StatusNotFound)
-					return
-				}
-				http.Error(w, "update focus failed", http.StatusInternalServerError)
-				return
-			}
+		if _, ok := requirePlanRole(ctx, w, tx, planID, uid, roleEditor); !ok {
+			return
 		}
-
-		if req.Steps != nil {
-			err = run(`
-		update public.plan_days d
-		set steps = $1
-		where d.plan_id = $2 and d.day_number = $3
-		  and exists (
-			select 1 from public.plans p
-			where p.id = d.plan_id and p.user_id = $4
-		  )
-	`, req.Steps, planID, dayNumber, uid)
-			if err != nil {
-				if errors.Is(err, pgx.ErrNoRows) {
-					http.Error(w, "not found", http.StatusNotFound)
-					return
-				}
-				http.Error(w, "update steps failed", http.StatusInternalServerError)
-				return
-			}
+		if !checkIfMatch(ctx, w, r, tx, planID) {
+			return
 		}
 
-		if req.IsDone != nil {
-			err = run(`
-		update public.plan_days d
-		set is_done = $1
-		where d.plan_id = $2 and d.day_number = $3
-		  and exists (
-			select 1 from public.plans p
-			where p.id = d.plan_id and p.user_id = $4
-		  )
-	`, *req.IsDone, planID, dayNumber, uid)
-			if err != nil {
-				if errors.Is(err, pgx.ErrNoRows) {
-					http.Error(w, "not found", http.StatusNotFound)
-					return
-				}
-				http.Error(w, "update is_done failed", http.StatusInternalServerError)
-				return
-			}
+		day, err := applyDayPatch(ctx, tx, planID, dayNumber, uid, "update_day", patch)
+		if err != nil {
+			internalError(w, "update failed", err)
+			return
+		}
+		if day == nil {
+			httpError(w, "plan_day not found", http.StatusNotFound)
+			return
+		}
+		res := DayUpdateResult{
+			OK: true, PlanID: planID, DayNumber: dayNumber,
+			IsDone: day.IsDone, DayStatus: day.Status,
+		}
+		if res.Status, err = refreshPlanCompletion(ctx, tx, planID); err != nil {
+			internalError(w, "update status failed", err)
+			return
+		}
+		if res.Version, err = touchPlan(ctx, tx, planID); err != nil {
+			internalError(w, "bump version failed", err)
+			return
 		}
 
 		if err := tx.Commit(ctx); err != nil {
-			http.Error(w, "commit failed", http.StatusInternalServerError)
+			internalError(w, "commit failed", err)
 			return
 		}
 
-		w.Header().Set("Content-Type", "application/json")
-		_ = json.NewEncoder(w).Encode(map[string]any{
-			"ok":         true,
-			"plan_id":    planID,
-			"day_number": dayNumber,
+		if (patch.has("is_done") || patch.has("status")) && dayCountsDone(res.DayStatus) {
+			recordDayDoneEvent(ctx, db, uid, planID, dayNumber)
+		}
+		publishPlanEvent(ctx, db, hub, realtime.Event{
+			Type: "day.updated", PlanID: planID, DayNumber: &dayNumber,
+			Version: res.Version, ActorID: uid.String(),
 		})
+
+		w.Header().Set("ETag", planETag(res.Version))
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(res)
 	}
 }
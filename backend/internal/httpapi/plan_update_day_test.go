@@ -0,0 +1,51 @@
+package httpapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"sliceapp-backend/internal/config"
+)
+
+func TestDayMergePatch(t *testing.T) {
+	h := NewRouter(nil, config.Config{}, nil)
+	const user = "8d3c2f1e-5b7a-4c9d-8e6f-0a1b2c3d4e5f"
+	const day = "/plans/0f1e2d3c-4b5a-4968-8776-655443322110/days/1"
+
+	cases := []struct {
+		name, path, body string
+		want             int
+		deprecated       bool
+	}{
+		{"merge patch with nulls", "/v1" + day, `{"status":null,"focus":"again"}`, http.StatusServiceUnavailable, false},
+		{"legacy alias", day, `{"is_done":true}`, http.StatusServiceUnavailable, true},
+		{"read-only member", "/v1" + day, `{"day_number":3}`, http.StatusBadRequest, false},
+		{"empty patch", "/v1" + day, `{}`, http.StatusBadRequest, false},
+		{"past the day cap", "/v1/plans/0f1e2d3c-4b5a-4968-8776-655443322110/days/366", `{"is_done":true}`, http.StatusBadRequest, false},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			req := httptest.NewRequest("PATCH", c.path, strings.NewReader(c.body))
+			req.Header.Set("X-User-Id", user)
+			req.Header.Set("Content-Type", mergePatchType)
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != c.want {
+				t.Fatalf("status = %d, want %d; body %s", rec.Code, c.want, rec.Body)
+			}
+			dep := rec.Header().Get("Deprecation")
+			if c.deprecated != (dep != "") {
+				t.Errorf("Deprecation = %q", dep)
+			}
+			if c.deprecated {
+				want := "</v1" + c.path + `>; rel="successor-version"`
+				if link := rec.Header().Get("Link"); link != want {
+					t.Errorf("Link = %q, want %q", link, want)
+				}
+			}
+		})
+	}
+}
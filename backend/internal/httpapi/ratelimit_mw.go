@@ -0,0 +1,87 @@
+package httpapi
+
+import (
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"sliceapp-backend/internal/config"
+	"sliceapp-backend/internal/ratelimit"
+)
+
+// limiter holds the token buckets shared by both route trees, so /v1 and
+// its deprecated aliases draw from the same limits.
+type limiter struct {
+	store      ratelimit.Store
+	trustProxy bool
+}
+
+func newLimiter(db *pgxpool.Pool, cfg config.Config) *limiter {
+	var store ratelimit.Store = ratelimit.NewMemory()
+	if cfg.RateLimitPG && db != nil {
+		store = ratelimit.NewPostgres(db)
+	}
+	return &limiter{store: store, trustProxy: cfg.TrustProxy}
+}
+
+// limit rejects requests over l with 429 and Retry-After. Buckets are
+// named scope:key(r). If the store fails, requests go through: a broken
+// limiter shouldn't take the API down with it.
+func (lm *limiter) limit(scope string, l ratelimit.Limit, key func(*http.Request) string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if l.Off() {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ok, wait, err := lm.store.Take(r.Context(), scope+":"+key(r), l)
+			if err != nil {
+				log.Printf("rate limit %s: %v", scope, err)
+			} else if !ok {
+				setRetryAfter(w, wait)
+				writeAPIError(w, http.StatusTooManyRequests, APIError{Message: "too many requests"})
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// clientIP is the address the request came from. Behind a trusted proxy
+// it is the last X-Forwarded-For entry, the one the proxy itself added;
+// earlier entries come from the client and can be forged.
+func (lm *limiter) clientIP(r *http.Request) string {
+	if lm.trustProxy {
+		if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
+			parts := strings.Split(xff, ",")
+			if ip := strings.TrimSpace(parts[len(parts)-1]); ip != "" {
+				return ip
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// userKey is the X-User-Id; only valid after requireUserID.
+func userKey(r *http.Request) string {
+	uid, _ := userIDFromCtx(r.Context())
+	return uid.String()
+}
+
+// setRetryAfter sends wait in whole seconds, rounded up.
+func setRetryAfter(w http.ResponseWriter, wait time.Duration) {
+	secs := int(math.Ceil(wait.Seconds()))
+	if secs < 1 {
+		secs = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(secs))
+}
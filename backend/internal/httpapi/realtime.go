@@ -0,0 +1,128 @@
+package httpapi
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/websocket"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"sliceapp-backend/internal/realtime"
+)
+
+const (
+	wsWriteWait  = 10 * time.Second
+	wsPongWait   = 60 * time.Second
+	wsPingPeriod = 50 * time.Second
+)
+
+var wsUpgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 1024,
+	// Auth is the X-User-Id header, not a cookie, so a foreign page can't
+	// ride on the user's session; mobile clients send no Origin at all.
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// planMemberIDs lists everyone who should hear about changes to planID.
+func planMemberIDs(ctx context.Context, q querier, planID string) ([]uuid.UUID, error) {
+	rows, err := q.Query(ctx, `
+		select user_id from public.plan_members where plan_id = $1
+	`, planID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// publishPlanEvent pushes ev to every member of the plan. Call it after
+// commit; failures are logged, never surfaced to the caller.
+func publishPlanEvent(ctx context.Context, db *pgxpool.Pool, hub *realtime.Broker, ev realtime.Event) {
+	if hub == nil || db == nil {
+		return
+	}
+	ids, err := planMemberIDs(ctx, db, ev.PlanID)
+	if err != nil {
+		log.Printf("realtime member lookup failed: %v", err)
+		return
+	}
+	hub.Publish(ctx, ev, ids)
+}
+
+// handleRealtime upgrades to a WebSocket that streams realtime.Event JSON
+// messages for every plan the user is a member of. The server only
+// writes; anything the client sends is ignored.
+func handleRealtime(hub *realtime.Broker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if hub == nil {
+			httpError(w, "realtime disabled", http.StatusServiceUnavailable)
+			return
+		}
+		uid, ok := userIDFromCtx(r.Context())
+		if !ok {
+			httpError(w, "missing user", http.StatusUnauthorized)
+			return
+		}
+
+		conn, err := wsUpgrader.Upgrade(w, r, nil)
+		if err != nil {
+			// Upgrade already wrote the error response.
+			return
+		}
+		defer conn.Close()
+
+		events, unsubscribe := hub.Subscribe(uid)
+		defer unsubscribe()
+
+		// Reader: keeps the pong deadline fresh and notices disconnects.
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			conn.SetReadLimit(4096)
+			_ = conn.SetReadDeadline(time.Now().Add(wsPongWait))
+			conn.SetPongHandler(func(string) error {
+				return conn.SetReadDeadline(time.Now().Add(wsPongWait))
+			})
+			for {
+				if _, _, err := conn.NextReader(); err != nil {
+					return
+				}
+			}
+		}()
+
+		ping := time.NewTicker(wsPingPeriod)
+		defer ping.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case ev, ok := <-events:
+				if !ok {
+					return
+				}
+				_ = conn.SetWriteDeadline(time.Now().Add(wsWriteWait))
+				if err := conn.WriteJSON(ev); err != nil {
+					return
+				}
+			case <-ping.C:
+				if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(wsWriteWait)); err != nil {
+					return
+				}
+			}
+		}
+	}
+}
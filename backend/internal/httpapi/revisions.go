@@ -0,0 +1,505 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"sliceapp-backend/internal/realtime"
+)
+
+// dayState is a day exactly as stored. Steps stay raw so a revert puts
+// back byte-for-byte what was there, even if it doesn't parse as steps.
+// DayKey is the day's identity across renumbering (migration 018) and
+// SkipCount how far it pushed the calendar; older snapshots have neither.
+type dayState struct {
+	DayNumber int             `json:"day_number"`
+	DayKey    string          `json:"day_key,omitempty"`
+	Focus     string          `json:"focus"`
+	Steps     json.RawMessage `json:"steps"`
+	IsDone    bool            `json:"is_done"`
+	Status    string          `json:"status,omitempty"`
+	SkipCount *int            `json:"skip_count,omitempty"`
+}
+
+type planState struct {
+	Title        string     `json:"title"`
+	Days         int        `json:"days"`
+	DailyMinutes int        `json:"daily_minutes"`
+	Items        []dayState `json:"items"`
+}
+
+type PlanRevision struct {
+	ID        int64           `json:"id"`
+	DayNumber *int            `json:"day_number"`
+	UserID    *string         `json:"user_id"`
+	Action    string          `json:"action"`
+	Before    json.RawMessage `json:"before"`
+	After     json.RawMessage `json:"after"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+type RevertRequest struct {
+	RevisionID int64 `json:"revision_id"`
+	// DayNumber limits the revert to one day; omit it to revert the whole plan.
+	DayNumber *int `json:"day_number,omitempty"`
+}
+
+// snapshotDay returns the stored state of one day, or nil if it doesn't exist.
+func snapshotDay(ctx context.Context, q querier, planID string, dayNumber int) (*dayState, error) {
+	s := dayState{DayNumber: dayNumber}
+	err := q.QueryRow(ctx, `
+		select day_key::text, focus, steps, is_done, status, skip_count
+		from public.plan_days
+		where plan_id = $1 and day_number = $2
+	`, planID, dayNumber).Scan(&s.DayKey, &s.Focus, &s.Steps, &s.IsDone, &s.Status, &s.SkipCount)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func snapshotPlan(ctx context.Context, q querier, planID string) (*planState, error) {
+	var s planState
+	err := q.QueryRow(ctx, `
+		select title, days, daily_minutes from public.plans where id = $1
+	`, planID).Scan(&s.Title, &s.Days, &s.DailyMinutes)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := q.Query(ctx, `
+		select day_number, day_key::text, focus, steps, is_done, status, skip_count
+		from public.plan_days
+		where plan_id = $1
+		order by day_number asc
+	`, planID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	s.Items = make([]dayState, 0)
+	for rows.Next() {
+		var d dayState
+		if err := rows.Scan(&d.DayNumber, &d.DayKey, &d.Focus, &d.Steps, &d.IsDone, &d.Status, &d.SkipCount); err != nil {
+			return nil, err
+		}
+		s.Items = append(s.Items, d)
+	}
+	return &s, rows.Err()
+}
+
+// recordRevision appends one entry to the plan's history.
+// dayNumber nil = the whole plan changed. A day revision also records the
+// day_key of the day now at dayNumber.
+func recordRevision(ctx context.Context, q querier, planID string, dayNumber *int, uid uuid.UUID, action string, before, after any) error {
+	beforeJSON, err := json.Marshal(before)
+	if err != nil {
+		return err
+	}
+	afterJSON, err := json.Marshal(after)
+	if err != nil {
+		return err
+	}
+	_, err = q.Exec(ctx, `
+		insert into public.plan_revisions (plan_id, day_number, day_key, user_id, action, before, after)
+		values ($1, $2,
+		        (select day_key from public.plan_days where plan_id = $1 and day_number = $2),
+		        $3, $4, $5, $6)
+	`, planID, dayNumber, uid, action, beforeJSON, afterJSON)
+	return err
+}
+
+// recordDayChange snapshots a day after a change and logs it against the
+// snapshot taken before the change.
+func recordDayChange(ctx context.Context, q querier, planID string, dayNumber int, uid uuid.UUID, action string, before *dayState) error {
+	after, err := snapshotDay(ctx, q, planID, dayNumber)
+	if err != nil {
+		return err
+	}
+	return recordRevision(ctx, q, planID, &dayNumber, uid, action, before, after)
+}
+
+// applyDayState writes s over the day; nil means the day must not exist.
+func applyDayState(ctx context.Context, q querier, planID string, dayNumber int, s *dayState) error {
+	if s == nil {
+		_, err := q.Exec(ctx, `
+			delete from public.plan_days where plan_id = $1 and day_number = $2
+		`, planID, dayNumber)
+		return err
+	}
+	steps := s.Steps
+	if len(steps) == 0 {
+		steps = json.RawMessage("[]")
+	}
+	// Snapshots from before day statuses existed have no status; derive
+	// it from is_done like the day_status trigger does.
+	status := s.Status
+	if status == "" {
+		status = dayPending
+		if s.IsDone {
+			status = dayDone
+		}
+	}
+	// The day_key goes back too, so a whole-plan revert of a move leaves
+	// each day's key with its content.
+	_, err := q.Exec(ctx, `
+		insert into public.plan_days (plan_id, day_number, day_key, focus, steps, is_done, status)
+		values ($1, $2, coalesce(nullif($7, '')::uuid, gen_random_uuid()), $3, $4, $5, $6)
+		on conflict (plan_id, day_number) do update
+		  set focus = excluded.focus, steps = excluded.steps,
+		      is_done = excluded.is_done, status = excluded.status,
+		      day_key = coalesce(nullif($7, '')::uuid, plan_days.day_key)
+	`, planID, dayNumber, s.Focus, steps, s.IsDone, status, s.DayKey)
+	if err != nil || s.SkipCount == nil {
+		return err
+	}
+	// Put skip_count back in its own write: the one above may have moved
+	// the day into skipped, which the day_status trigger counts as a new
+	// skip. With status unchanged the trigger keeps the value set here.
+	_, err = q.Exec(ctx, `
+		update public.plan_days set skip_count = $3
+		where plan_id = $1 and day_number = $2 and skip_count <> $3
+	`, planID, dayNumber, *s.SkipCount)
+	return err
+}
+
+// applyPlanState writes the plan fields and every day in s, dropping days
+// beyond the snapshot. Days are upserted so claims on them survive.
+func applyPlanState(ctx context.Context, q querier, planID string, s *planState) error {
+	_, err := q.Exec(ctx, `
+		update public.plans set title = $2, days = $3, daily_minutes = $4
+		where id = $1
+	`, planID, s.Title, s.Days, s.DailyMinutes)
+	if err != nil {
+		return err
+	}
+	keep := make([]int32, 0, len(s.Items))
+	for i := range s.Items {
+		d := s.Items[i]
+		if err := applyDayState(ctx, q, planID, d.DayNumber, &d); err != nil {
+			return err
+		}
+		keep = append(keep, int32(d.DayNumber))
+	}
+	_, err = q.Exec(ctx, `
+		delete from public.plan_days
+		where plan_id = $1 and not (day_number = any($2))
+	`, planID, keep)
+	return err
+}
+
+// handleGetPlanHistory lists revisions newest first.
+// ?day= narrows to the revisions of the day now at that number, wherever
+// it was when they were made. ?before=<id> pages, ?limit= caps (default 50).
+func handleGetPlanHistory(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if db == nil {
+			httpError(w, "db not connected", http.StatusServiceUnavailable)
+			return
+		}
+		uid, ok := userIDFromCtx(r.Context())
+		if !ok {
+			httpError(w, "missing user", http.StatusUnauthorized)
+			return
+		}
+
+		planID := chi.URLParam(r, "id")
+		qs := r.URL.Query()
+
+		var day *int
+		if v := qs.Get("day"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 {
+				httpError(w, "invalid day", http.StatusBadRequest)
+				return
+			}
+			day = &n
+		}
+		var before *int64
+		if v := qs.Get("before"); v != "" {
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				httpError(w, "invalid before", http.StatusBadRequest)
+				return
+			}
+			before = &n
+		}
+		limit := 50
+		if v := qs.Get("limit"); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil || n <= 0 {
+				httpError(w, "invalid limit", http.StatusBadRequest)
+				return
+			}
+			limit = clampInt(n, 1, 200)
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 8*time.Second)
+		defer cancel()
+
+		if _, ok := requirePlanRole(ctx, w, db, planID, uid, roleViewer); !ok {
+			return
+		}
+
+		rows, err := db.Query(ctx, `
+			select id, day_number, user_id, action, before, after, created_at
+			from public.plan_revisions
+			where plan_id = $1
+			  and ($2::int is null or day_key = (
+			        select day_key from public.plan_days where plan_id = $1 and day_number = $2))
+			  and ($3::bigint is null or id < $3)
+			order by id desc
+			limit $4
+		`, planID, day, before, limit)
+		if err != nil {
+			internalError(w, "query failed", err)
+			return
+		}
+		defer rows.Close()
+
+		out := make([]PlanRevision, 0)
+		for rows.Next() {
+			var rev PlanRevision
+			if err := rows.Scan(&rev.ID, &rev.DayNumber, &rev.UserID, &rev.Action, &rev.Before, &rev.After, &rev.CreatedAt); err != nil {
+				internalError(w, "scan failed", err)
+				return
+			}
+			out = append(out, rev)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"plan_id":   planID,
+			"revisions": out,
+		})
+	}
+}
+
+// handleRevertPlan restores the state from just before revision_id by
+// undoing that revision and every later one, newest first. With day_number
+// only the revisions of the day now at that number are undone, matched by
+// day_key and written back at its current number; a day that was removed
+// can't be reverted into another one's place. The revert is itself a
+// revision, so it can be undone too.
+func handleRevertPlan(db *pgxpool.Pool, hub *realtime.Broker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if db == nil {
+			httpError(w, "db not connected", http.StatusServiceUnavailable)
+			return
+		}
+		uid, ok := userIDFromCtx(r.Context())
+		if !ok {
+			httpError(w, "missing user", http.StatusUnauthorized)
+			return
+		}
+
+		planID := chi.URLParam(r, "id")
+
+		var req RevertRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			httpError(w, "invalid json body", http.StatusBadRequest)
+			return
+		}
+		if req.RevisionID <= 0 {
+			httpError(w, "missing revision_id", http.StatusBadRequest)
+			return
+		}
+		if req.DayNumber != nil && *req.DayNumber <= 0 {
+			httpError(w, "invalid day_number", http.StatusBadRequest)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+
+		tx, err := db.Begin(ctx)
+		if err != nil {
+			internalError(w, "begin tx failed", err)
+			return
+		}
+		defer func() { _ = tx.Rollback(ctx) }()
+
+		if _, ok := requirePlanRole(ctx, w, tx, planID, uid, roleEditor); !ok {
+			return
+		}
+
+		// Locks the plan against other writers and honours If-Match.
+		if !checkIfMatch(ctx, w, r, tx, planID) {
+			return
+		}
+
+		var target PlanRevision
+		var targetKey *string
+		err = tx.QueryRow(ctx, `
+			select id, day_number, day_key::text from public.plan_revisions
+			where id = $1 and plan_id = $2
+		`, req.RevisionID, planID).Scan(&target.ID, &target.DayNumber, &targetKey)
+		if err != nil {
+			httpError(w, "revision not found", http.StatusNotFound)
+			return
+		}
+		var dayKey *string
+		if req.DayNumber != nil {
+			err = tx.QueryRow(ctx, `
+				select day_key::text from public.plan_days
+				where plan_id = $1 and day_number = $2
+			`, planID, *req.DayNumber).Scan(&dayKey)
+			if errors.Is(err, pgx.ErrNoRows) {
+				httpError(w, "plan_day not found", http.StatusNotFound)
+				return
+			}
+			if err != nil {
+				internalError(w, "query failed", err)
+				return
+			}
+			if targetKey == nil || *targetKey != *dayKey {
+				httpError(w, "revision does not belong to that day", http.StatusBadRequest)
+				return
+			}
+		}
+
+		// Snapshot the scope first so the revert itself is recorded.
+		var beforeState any
+		var oldCount int
+		if req.DayNumber != nil {
+			beforeState, err = snapshotDay(ctx, tx, planID, *req.DayNumber)
+		} else {
+			var ps *planState
+			ps, err = snapshotPlan(ctx, tx, planID)
+			if err == nil {
+				beforeState, oldCount = ps, len(ps.Items)
+			}
+		}
+		if err != nil {
+			internalError(w, "snapshot failed", err)
+			return
+		}
+
+		rows, err := tx.Query(ctx, `
+			select id, day_number, before
+			from public.plan_revisions
+			where plan_id = $1 and id >= $2
+			  and ($3::uuid is null or day_key = $3::uuid)
+			order by id desc
+		`, planID, req.RevisionID, dayKey)
+		if err != nil {
+			internalError(w, "query revisions failed", err)
+			return
+		}
+		var undo []PlanRevision
+		for rows.Next() {
+			var rev PlanRevision
+			if err := rows.Scan(&rev.ID, &rev.DayNumber, &rev.Before); err != nil {
+				rows.Close()
+				internalError(w, "scan failed", err)
+				return
+			}
+			undo = append(undo, rev)
+		}
+		rows.Close()
+
+		for _, rev := range undo {
+			if rev.DayNumber != nil {
+				var s *dayState
+				if err := json.Unmarshal(rev.Before, &s); err != nil {
+					internalError(w, "corrupt revision", err)
+					return
+				}
+				// A day-scoped revert writes where the day is now; a
+				// whole-plan one replays in order, so the number the
+				// revision was made under is the right one.
+				n := *rev.DayNumber
+				if req.DayNumber != nil {
+					n = *req.DayNumber
+				}
+				err = applyDayState(ctx, tx, planID, n, s)
+			} else {
+				var s *planState
+				if err := json.Unmarshal(rev.Before, &s); err != nil || s == nil {
+					internalError(w, "corrupt revision", err)
+					return
+				}
+				err = applyPlanState(ctx, tx, planID, s)
+			}
+			if err != nil {
+				internalError(w, "revert failed", err)
+				return
+			}
+		}
+		// Days a remove or move had deleted may be back; clear their
+		// tombstones like reorderDays does, or clients drop them again.
+		if req.DayNumber == nil {
+			newCount, err := countPlanDays(ctx, tx, planID)
+			if err != nil {
+				internalError(w, "revert failed", err)
+				return
+			}
+			if err := settleDayTombstones(ctx, tx, planID, oldCount, newCount); err != nil {
+				internalError(w, "revert failed", err)
+				return
+			}
+		}
+
+		var afterState any
+		if req.DayNumber != nil {
+			afterState, err = snapshotDay(ctx, tx, planID, *req.DayNumber)
+		} else {
+			afterState, err = snapshotPlan(ctx, tx, planID)
+		}
+		if err != nil {
+			internalError(w, "snapshot failed", err)
+			return
+		}
+		if err := recordRevision(ctx, tx, planID, req.DayNumber, uid, "revert", beforeState, afterState); err != nil {
+			internalError(w, "record revision failed", err)
+			return
+		}
+		if _, err := refreshPlanCompletion(ctx, tx, planID); err != nil {
+			internalError(w, "update status failed", err)
+			return
+		}
+		version, err := touchPlan(ctx, tx, planID)
+		if err != nil {
+			internalError(w, "bump version failed", err)
+			return
+		}
+
+		if err := tx.Commit(ctx); err != nil {
+			internalError(w, "commit failed", err)
+			return
+		}
+
+		evType := "plan.updated"
+		if req.DayNumber != nil {
+			evType = "day.updated"
+		}
+		publishPlanEvent(ctx, db, hub, realtime.Event{
+			Type: evType, PlanID: planID, DayNumber: req.DayNumber,
+			Version: version, ActorID: uid.String(),
+		})
+
+		w.Header().Set("ETag", planETag(version))
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"ok":          true,
+			"plan_id":     planID,
+			"revision_id": req.RevisionID,
+			"day_number":  req.DayNumber,
+			"undone":      len(undo),
+			"version":     version,
+		})
+	}
+}
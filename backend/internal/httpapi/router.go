@@ -3,13 +3,28 @@ package httpapi
 import (
 	"net/http"
 	"sliceapp-backend/internal/config"
+	"sliceapp-backend/internal/ratelimit"
+	"sliceapp-backend/internal/realtime"
+	"sliceapp-backend/internal/splitcache"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-func NewRouter(db *pgxpool.Pool, cfg config.Config) http.Handler {
+func NewRouter(db *pgxpool.Pool, cfg config.Config, hub *realtime.Broker) http.Handler {
+	// The spec is embedded; failing to load it is a build mistake.
+	if _, err := loadOpenAPI(); err != nil {
+		panic("openapi.yaml: " + err.Error())
+	}
+
 	r := chi.NewRouter()
+	r.Use(requestID)
+	r.NotFound(func(w http.ResponseWriter, r *http.Request) {
+		httpError(w, "no such endpoint", http.StatusNotFound)
+	})
+	r.MethodNotAllowed(func(w http.ResponseWriter, r *http.Request) {
+		writeAPIError(w, http.StatusMethodNotAllowed, APIError{Code: "method_not_allowed", Message: "method not allowed"})
+	})
 
 	r.Get("/health", func(w http.ResponseWriter, r *http.Request) {
 		w.WriteHeader(http.StatusOK)
@@ -19,22 +34,99 @@ func NewRouter(db *pgxpool.Pool, cfg config.Config) http.Handler {
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte("v-debug-logs-1"))
 	})
+	r.Get("/openapi.json", handleOpenAPI())
+
+	lm := newLimiter(db, cfg)
+	sc := newSplitterCache(db, cfg)
+	r.Route(apiPrefix, func(v chi.Router) {
+		apiRoutes(v, db, cfg, hub, lm, sc)
+	})
+	// The unversioned API from before /v1, kept for older app builds.
+	r.Group(func(lr chi.Router) {
+		lr.Use(deprecatedAlias)
+		apiRoutes(lr, db, cfg, hub, lm, sc)
+	})
+
+	return r
+}
+
+// apiRoutes registers the versioned API on r.
+func apiRoutes(r chi.Router, db *pgxpool.Pool, cfg config.Config, hub *realtime.Broker, lm *limiter, sc *splitcache.Cache) {
+	r.Use(lm.limit("ip", ratelimit.PerMinute(cfg.IPRatePerMinute), lm.clientIP))
 
 	// No user required
-	r.Post("/auth/anonymous", handleAnonymousUser(db))
+	r.With(lm.limit("anon", ratelimit.PerHour(cfg.AnonUsersPerHour), lm.clientIP), validateRequest).
+		Post("/auth/anonymous", handleAnonymousUser(db))
+	r.With(validateRequest).Get("/shared/{token}", handleGetShared(db))
 
-	// User required
+	// User required. Requests are validated only once they got past the
+	// user and its rate limit.
 	r.Group(func(pr chi.Router) {
 		pr.Use(requireUserID)
+		pr.Use(lm.limit("user", ratelimit.PerMinute(cfg.UserRatePerMinute), userKey))
+		pr.Use(validateRequest)
+		pr.Use(idempotency(db))
 
 		pr.Get("/plans", handleListPlans(db))
 		pr.Get("/plans/{id}", handleGetPlan(db))
-		pr.Post("/plan", handleCreatePlan(db, cfg))
+		pr.Patch("/plans/{id}", handleUpdatePlan(db, cfg, hub))
+		pr.Post("/plan", handleCreatePlan(db, cfg, sc))
 
-		pr.Patch("/plans/{id}/days/{day}", handlePatchPlanDay(db))
-		pr.Patch("/plans/{id}/days/{dayNumber}", handleUpdatePlanDay(db))
-		pr.Delete("/plans/{id}", handleDeletePlan(db))
-	})
+		pr.Patch("/plans/{id}/days/{day}", handleUpdatePlanDay(db, hub))
+		pr.Post("/plans/{id}/days", handleInsertPlanDay(db, cfg, hub))
+		pr.Post("/plans/{id}/days:batch", handleBatchPlanDays(db, hub))
+		pr.Delete("/plans/{id}/days/{day}", handleRemovePlanDay(db, hub))
+		pr.Post("/plans/{id}/days/{day}/move", handleMovePlanDay(db, hub))
+		pr.Delete("/plans/{id}", handleDeletePlan(db, hub))
+		pr.Post("/plans/{id}/restore", handleRestorePlan(db, hub))
+		pr.Put("/plans/{id}/status", handleSetPlanStatus(db, hub))
+		pr.Get("/plans/{id}/progress", handleGetPlanProgress(db))
+		pr.Get("/trash", handleListTrash(db, cfg))
 
-	return r
+		pr.Get("/tags", handleListTags(db))
+		pr.Post("/tags", handleCreateTag(db))
+		pr.Patch("/tags/{tagId}", handleUpdateTag(db))
+		pr.Delete("/tags/{tagId}", handleDeleteTag(db))
+		pr.Put("/plans/{id}/tags/{tagId}", handleTagPlan(db))
+		pr.Delete("/plans/{id}/tags/{tagId}", handleUntagPlan(db))
+		pr.Get("/stats/tags", handleTagStats(db))
+
+		pr.Post("/plans/{id}/share", handleCreateShare(db))
+		pr.Delete("/plans/{id}/share", handleDeleteShare(db))
+
+		pr.Get("/plans/{id}/members", handleGetPlanTeam(db))
+		pr.Post("/plans/{id}/members", handleAddPlanMember(db))
+		pr.Patch("/plans/{id}/members/{userId}", handleUpdatePlanMember(db))
+		pr.Delete("/plans/{id}/members/{userId}", handleRemovePlanMember(db))
+		pr.Put("/plans/{id}/days/{day}/completion", handleSetMemberCompletion(db, hub))
+		pr.Post("/plans/{id}/days/{day}/steps/{step}/claim", handleClaimStep(db))
+		pr.Delete("/plans/{id}/days/{day}/steps/{step}/claim", handleUnclaimStep(db))
+
+		pr.Get("/plans/{id}/history", handleGetPlanHistory(db))
+		pr.Post("/plans/{id}/revert", handleRevertPlan(db, hub))
+		pr.Post("/plans/{id}/duplicate", handleDuplicatePlan(db))
+		pr.Post("/plans/{id}/template", handleSaveTemplate(db))
+		pr.Get("/templates", handleListTemplates(db))
+		pr.Get("/templates/{templateId}", handleGetTemplate(db))
+		pr.Delete("/templates/{templateId}", handleDeleteTemplate(db))
+		pr.Post("/templates/{templateId}/plans", handleCreatePlanFromTemplate(db))
+
+		pr.Get("/sync", handleSyncPull(db))
+		pr.Post("/sync", handleSyncPush(db, hub))
+
+		pr.Get("/ws", handleRealtime(hub))
+
+		pr.Post("/partners/invites", handleCreatePartnerInvite(db))
+		pr.Get("/partners/invites", handleListPartnerInvites(db))
+		pr.Post("/partners/invites/{inviteId}/accept", handleRespondPartnerInvite(db, "accepted"))
+		pr.Post("/partners/invites/{inviteId}/decline", handleRespondPartnerInvite(db, "declined"))
+		pr.Get("/partners", handleListPartners(db))
+		pr.Get("/partners/feed", handlePartnerFeed(db))
+		pr.Post("/partners/feed/seen", handleMarkFeedSeen(db))
+		pr.Delete("/partners/{userId}", handleRemovePartner(db))
+		pr.Get("/partners/{userId}/progress", handleGetPartnerProgress(db))
+		pr.Post("/partners/{userId}/nudges", handleSendNudge(db))
+
+		pr.With(requireAdmin(cfg)).Get("/admin/usage", handleAdminUsage(db, cfg))
+	})
 }
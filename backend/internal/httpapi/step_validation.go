@@ -0,0 +1,97 @@
+package httpapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	maxStepsPerDay     = 10
+	minStepMinutes     = 1
+	maxStepMinutes     = 180
+	maxStepTitleLen    = 120
+	maxStepDetailLen   = 500
+	maxValidationFails = 20
+)
+
+// FieldError points at one invalid field. Step is the 0-based index into
+// steps; it is omitted for errors about the array itself.
+type FieldError struct {
+	Step    *int   `json:"step,omitempty"`
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+func (e FieldError) Error() string {
+	if e.Step == nil {
+		return e.Field + ": " + e.Message
+	}
+	return fmt.Sprintf("steps[%d].%s: %s", *e.Step, e.Field, e.Message)
+}
+
+// validateSteps trims text fields in place and reports every problem it
+// finds, up to maxValidationFails.
+func validateSteps(steps []PlanDayStep) []FieldError {
+	var errs []FieldError
+	if len(steps) > maxStepsPerDay {
+		errs = append(errs, FieldError{Field: "steps", Message: fmt.Sprintf("at most %d steps per day", maxStepsPerDay)})
+	}
+	for i := range steps {
+		s := &steps[i]
+		idx := i
+		fail := func(field, msg string) {
+			errs = append(errs, FieldError{Step: &idx, Field: field, Message: msg})
+		}
+
+		s.Title = strings.TrimSpace(s.Title)
+		s.Deliverable = strings.TrimSpace(s.Deliverable)
+		s.DoneDef = strings.TrimSpace(s.DoneDef)
+
+		switch {
+		case s.Title == "":
+			fail("title", "is required")
+		case utf8.RuneCountInString(s.Title) > maxStepTitleLen:
+			fail("title", fmt.Sprintf("must be at most %d characters", maxStepTitleLen))
+		}
+		if s.Minutes < minStepMinutes || s.Minutes > maxStepMinutes {
+			fail("minutes", fmt.Sprintf("must be between %d and %d", minStepMinutes, maxStepMinutes))
+		}
+		if utf8.RuneCountInString(s.Deliverable) > maxStepDetailLen {
+			fail("deliverable", fmt.Sprintf("must be at most %d characters", maxStepDetailLen))
+		}
+		switch {
+		case s.DoneDef == "":
+			fail("done_definition", "is required")
+		case utf8.RuneCountInString(s.DoneDef) > maxStepDetailLen:
+			fail("done_definition", fmt.Sprintf("must be at most %d characters", maxStepDetailLen))
+		}
+
+		if len(errs) >= maxValidationFails {
+			return errs[:maxValidationFails]
+		}
+	}
+	return errs
+}
+
+// decodeSteps parses and validates a raw steps array.
+func decodeSteps(raw json.RawMessage) ([]PlanDayStep, []FieldError) {
+	var steps []PlanDayStep
+	if err := json.Unmarshal(raw, &steps); err != nil || steps == nil {
+		return nil, []FieldError{{Field: "steps", Message: "must be an array of step objects"}}
+	}
+	if errs := validateSteps(steps); len(errs) > 0 {
+		return nil, errs
+	}
+	return steps, nil
+}
+
+func writeValidationErrors(w http.ResponseWriter, errs []FieldError) {
+	writeAPIError(w, http.StatusBadRequest, APIError{
+		Code:    "validation_failed",
+		Message: "validation failed",
+		Details: errs,
+	})
+}
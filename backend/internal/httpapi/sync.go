@@ -0,0 +1,669 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"sliceapp-backend/internal/realtime"
+)
+
+// Clients may be a little ahead of the server clock; anything further in
+// the future is clamped so one bad clock can't win every conflict forever.
+const maxClientClockSkew = time.Minute
+
+const maxSyncMutations = 200
+
+type SyncPlan struct {
+	ID           string               `json:"id"`
+	Title        string               `json:"title"`
+	Days         int                  `json:"days"`
+	DailyMinutes int                  `json:"daily_minutes"`
+	GoalType     string               `json:"goal_type,omitempty"`
+	Status       string               `json:"status"`
+	Role         string               `json:"role"`
+	Version      int                  `json:"version"`
+	CreatedAt    time.Time            `json:"created_at"`
+	UpdatedAt    time.Time            `json:"updated_at"`
+	FieldTimes   map[string]time.Time `json:"field_times"`
+}
+
+type SyncDay struct {
+	PlanID     string               `json:"plan_id"`
+	DayNumber  int                  `json:"day_number"`
+	Focus      string               `json:"focus"`
+	Steps      json.RawMessage      `json:"steps"`
+	IsDone     bool                 `json:"is_done"`
+	Status     string               `json:"status"`
+	UpdatedAt  time.Time            `json:"updated_at"`
+	FieldTimes map[string]time.Time `json:"field_times"`
+}
+
+type SyncCompletion struct {
+	PlanID    string    `json:"plan_id"`
+	DayNumber int       `json:"day_number"`
+	UserID    string    `json:"user_id"`
+	IsDone    bool      `json:"is_done"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type SyncDeletion struct {
+	Kind      string    `json:"kind"` // plan | day
+	PlanID    string    `json:"plan_id"`
+	DayNumber *int      `json:"day_number"`
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+type SyncMutation struct {
+	ClientID  string                     `json:"client_id,omitempty"`
+	Type      string                     `json:"type"` // plan | day | completion | delete_plan
+	PlanID    string                     `json:"plan_id"`
+	DayNumber int                        `json:"day_number,omitempty"`
+	Fields    map[string]json.RawMessage `json:"fields,omitempty"`
+	ChangedAt time.Time                  `json:"changed_at"`
+}
+
+type SyncResult struct {
+	ClientID string   `json:"client_id,omitempty"`
+	Status   string   `json:"status"` // applied | partial | stale | rejected
+	Applied  []string `json:"applied,omitempty"`
+	Stale    []string `json:"stale,omitempty"`
+	Error    string   `json:"error,omitempty"`
+}
+
+type SyncPushRequest struct {
+	Since     string         `json:"since"`
+	Mutations []SyncMutation `json:"mutations"`
+}
+
+type SyncResponse struct {
+	Cursor      string           `json:"cursor"`
+	Plans       []SyncPlan       `json:"plans"`
+	Days        []SyncDay        `json:"days"`
+	Completions []SyncCompletion `json:"completions"`
+	Deleted     []SyncDeletion   `json:"deleted"`
+	Results     []SyncResult     `json:"results,omitempty"`
+}
+
+// Cursors are "x" plus a transaction id (xid8): the xmin of the snapshot
+// the previous pull read from.
+const syncCursorPrefix = "x"
+
+// parseSyncCursor reads a cursor from loadSyncChanges. A bare number is a
+// cursor from before cursors were transaction ids; it can't be compared
+// with one, so it gets a full pull.
+func parseSyncCursor(s string) (uint64, error) {
+	if s == "" {
+		return 0, nil
+	}
+	digits, ok := strings.CutPrefix(s, syncCursorPrefix)
+	n, err := strconv.ParseUint(digits, 10, 64)
+	if err != nil {
+		return 0, errors.New("invalid cursor")
+	}
+	if !ok {
+		return 0, nil
+	}
+	return n, nil
+}
+
+// loadSyncChanges returns every change visible to uid written by a
+// transaction at or after cursor since. A plan the user joined after the
+// cursor is sent in full, because its rows may be older than the cursor.
+//
+// The next cursor is the xmin of the snapshot the changes were read from,
+// not the newest change seen: transactions still running at that point
+// may hold older sequence numbers and commit later. Rows written at or
+// after xmin that were already visible are sent again next time; clients
+// apply changes idempotently, so that is only a little extra payload.
+func loadSyncChanges(ctx context.Context, db *pgxpool.Pool, uid uuid.UUID, since uint64) (SyncResponse, error) {
+	resp := SyncResponse{
+		Cursor:      syncCursorPrefix + strconv.FormatUint(since, 10),
+		Plans:       make([]SyncPlan, 0),
+		Days:        make([]SyncDay, 0),
+		Completions: make([]SyncCompletion, 0),
+		Deleted:     make([]SyncDeletion, 0),
+	}
+
+	// Repeatable read, so the xmin and the changes come from one snapshot.
+	tx, err := db.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return resp, err
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	var xmin string
+	if err := tx.QueryRow(ctx, `select pg_snapshot_xmin(pg_current_snapshot())::text`).Scan(&xmin); err != nil {
+		return resp, err
+	}
+
+	rows, err := tx.Query(ctx, `
+		with mine as (
+			select pm.plan_id, pm.role, pm.change_seq as member_seq, pm.change_xid as member_xid, p.deleted_at
+			from public.plan_members pm
+			join public.plans p on p.id = pm.plan_id
+			where pm.user_id = $1
+		)
+		select greatest(p.change_seq, m.member_seq), 'plan',
+		       jsonb_build_object(
+		         'id', p.id, 'title', p.title, 'days', p.days,
+		         'daily_minutes', p.daily_minutes, 'goal_type', coalesce(p.goal_type, ''),
+		         'status', p.status, 'role', m.role, 'version', p.version, 'created_at', p.created_at,
+		         'updated_at', p.updated_at, 'field_times', p.field_times)
+		from public.plans p
+		join mine m on m.plan_id = p.id
+		where p.deleted_at is null and greatest(p.change_xid, m.member_xid) >= $2::text::xid8
+		union all
+		select greatest(p.change_seq, m.member_seq), 'deleted',
+		       jsonb_build_object(
+		         'kind', 'plan', 'plan_id', p.id, 'day_number', null,
+		         'deleted_at', p.deleted_at)
+		from public.plans p
+		join mine m on m.plan_id = p.id
+		where p.deleted_at is not null and greatest(p.change_xid, m.member_xid) >= $2::text::xid8
+		union all
+		select greatest(d.change_seq, m.member_seq), 'day',
+		       jsonb_build_object(
+		         'plan_id', d.plan_id, 'day_number', d.day_number, 'focus', d.focus,
+		         'steps', d.steps, 'is_done', d.is_done, 'status', d.status,
+		         'updated_at', d.updated_at, 'field_times', d.field_times)
+		from public.plan_days d
+		join mine m on m.plan_id = d.plan_id
+		where m.deleted_at is null and greatest(d.change_xid, m.member_xid) >= $2::text::xid8
+		union all
+		select greatest(md.change_seq, m.member_seq), 'completion',
+		       jsonb_build_object(
+		         'plan_id', md.plan_id, 'day_number', md.day_number, 'user_id', md.user_id,
+		         'is_done', md.is_done, 'updated_at', md.updated_at)
+		from public.plan_member_days md
+		join mine m on m.plan_id = md.plan_id
+		where m.deleted_at is null and greatest(md.change_xid, m.member_xid) >= $2::text::xid8
+		union all
+		select t.change_seq, 'deleted',
+		       jsonb_build_object(
+		         'kind', t.kind, 'plan_id', t.plan_id, 'day_number', t.day_number,
+		         'deleted_at', t.deleted_at)
+		from public.sync_tombstones t
+		where t.user_ids @> array[$1::uuid] and t.change_xid >= $2::text::xid8
+		order by 1
+	`, uid, strconv.FormatUint(since, 10))
+	if err != nil {
+		return resp, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var seq int64
+		var kind string
+		var payload []byte
+		if err := rows.Scan(&seq, &kind, &payload); err != nil {
+			return resp, err
+		}
+
+		switch kind {
+		case "plan":
+			var p SyncPlan
+			err = json.Unmarshal(payload, &p)
+			resp.Plans = append(resp.Plans, p)
+		case "day":
+			var d SyncDay
+			err = json.Unmarshal(payload, &d)
+			resp.Days = append(resp.Days, d)
+		case "completion":
+			var c SyncCompletion
+			err = json.Unmarshal(payload, &c)
+			resp.Completions = append(resp.Completions, c)
+		case "deleted":
+			var d SyncDeletion
+			err = json.Unmarshal(payload, &d)
+			resp.Deleted = append(resp.Deleted, d)
+		}
+		if err != nil {
+			return resp, fmt.Errorf("decode %s change: %w", kind, err)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return resp, err
+	}
+
+	resp.Cursor = syncCursorPrefix + xmin
+	return resp, nil
+}
+
+// handleSyncPull: GET /sync?since=<cursor>. Omit since for a full snapshot.
+func handleSyncPull(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if db == nil {
+			httpError(w, "db not connected", http.StatusServiceUnavailable)
+			return
+		}
+		uid, ok := userIDFromCtx(r.Context())
+		if !ok {
+			httpError(w, "missing user", http.StatusUnauthorized)
+			return
+		}
+
+		since, err := parseSyncCursor(r.URL.Query().Get("since"))
+		if err != nil {
+			httpError(w, "invalid since cursor", http.StatusBadRequest)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 15*time.Second)
+		defer cancel()
+
+		resp, err := loadSyncChanges(ctx, db, uid, since)
+		if err != nil {
+			internalError(w, "sync failed", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(resp)
+	}
+}
+
+// handleSyncPush: POST /sync applies queued offline mutations, each in its
+// own transaction, with last-writer-wins per field. The response carries a
+// result per mutation plus every change since the request's cursor
+// (including the ones just applied), so one round trip catches up.
+func handleSyncPush(db *pgxpool.Pool, hub *realtime.Broker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if db == nil {
+			httpError(w, "db not connected", http.StatusServiceUnavailable)
+			return
+		}
+		uid, ok := userIDFromCtx(r.Context())
+		if !ok {
+			httpError(w, "missing user", http.StatusUnauthorized)
+			return
+		}
+
+		var req SyncPushRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			httpError(w, "invalid json body", http.StatusBadRequest)
+			return
+		}
+		since, err := parseSyncCursor(req.Since)
+		if err != nil {
+			httpError(w, "invalid since cursor", http.StatusBadRequest)
+			return
+		}
+		if len(req.Mutations) > maxSyncMutations {
+			httpError(w, "too many mutations", http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 30*time.Second)
+		defer cancel()
+
+		results := make([]SyncResult, 0, len(req.Mutations))
+		for _, m := range req.Mutations {
+			res := applySyncMutation(ctx, db, hub, uid, m)
+			res.ClientID = m.ClientID
+			results = append(results, res)
+		}
+
+		resp, err := loadSyncChanges(ctx, db, uid, since)
+		if err != nil {
+			internalError(w, "sync failed", err)
+			return
+		}
+		resp.Results = results
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(resp)
+	}
+}
+
+// syncField is one column a sync mutation may write.
+type syncField struct {
+	column string
+	// decode validates the raw JSON and returns the value to store.
+	decode func(json.RawMessage) (any, error)
+}
+
+func decodeNonEmptyString(raw json.RawMessage) (any, error) {
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return nil, errors.New("must be a string")
+	}
+	if strings.TrimSpace(s) == "" {
+		return nil, errors.New("must not be empty")
+	}
+	return s, nil
+}
+
+func decodeString(raw json.RawMessage) (any, error) {
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil {
+		return nil, errors.New("must be a string")
+	}
+	return s, nil
+}
+
+func decodePositiveInt(raw json.RawMessage) (any, error) {
+	var n int
+	if err := json.Unmarshal(raw, &n); err != nil || n <= 0 {
+		return nil, errors.New("must be a positive integer")
+	}
+	return n, nil
+}
+
+func decodeBool(raw json.RawMessage) (any, error) {
+	var b bool
+	if err := json.Unmarshal(raw, &b); err != nil {
+		return nil, errors.New("must be a boolean")
+	}
+	return b, nil
+}
+
+func decodeDayStatus(raw json.RawMessage) (any, error) {
+	var s string
+	if err := json.Unmarshal(raw, &s); err != nil || !dayStatuses[s] {
+		return nil, errors.New("must be pending, done, bad_day or skipped")
+	}
+	return s, nil
+}
+
+func decodeStepsArray(raw json.RawMessage) (any, error) {
+	steps, errs := decodeSteps(raw)
+	if len(errs) > 0 {
+		e := errs[0]
+		if e.Step == nil {
+			return nil, errors.New(e.Message)
+		}
+		return nil, fmt.Errorf("at [%d]: %s %s", *e.Step, e.Field, e.Message)
+	}
+	b, _ := json.Marshal(steps)
+	return b, nil
+}
+
+var syncPlanFields = map[string]syncField{
+	"title":         {"title", decodeNonEmptyString},
+	"daily_minutes": {"daily_minutes", decodePositiveInt},
+}
+
+var syncDayFields = map[string]syncField{
+	"focus":   {"focus", decodeString},
+	"steps":   {"steps", decodeStepsArray},
+	"is_done": {"is_done", decodeBool},
+	"status":  {"status", decodeDayStatus},
+}
+
+func rejected(msg string) SyncResult {
+	return SyncResult{Status: "rejected", Error: msg}
+}
+
+func applySyncMutation(ctx context.Context, db *pgxpool.Pool, hub *realtime.Broker, uid uuid.UUID, m SyncMutation) SyncResult {
+	changedAt := m.ChangedAt
+	now := time.Now()
+	if changedAt.IsZero() || changedAt.After(now.Add(maxClientClockSkew)) {
+		changedAt = now
+	}
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return rejected("begin tx failed")
+	}
+	defer func() { _ = tx.Rollback(ctx) }()
+
+	min := roleEditor
+	if m.Type == "delete_plan" {
+		min = roleOwner
+	}
+	role, err := planRoleFor(ctx, tx, m.PlanID, uid)
+	if err != nil {
+		return rejected("permission check failed")
+	}
+	if role == roleNone {
+		return rejected("plan not found")
+	}
+	if !role.atLeast(min) {
+		return rejected("forbidden")
+	}
+
+	var res SyncResult
+	switch m.Type {
+	case "plan":
+		res = syncWriteFields(ctx, tx, uid, m, changedAt, syncPlanFields)
+	case "day":
+		if m.DayNumber <= 0 {
+			return rejected("invalid day_number")
+		}
+		res = syncWriteFields(ctx, tx, uid, m, changedAt, syncDayFields)
+	case "completion":
+		res = syncWriteCompletion(ctx, tx, uid, m, changedAt)
+	case "delete_plan":
+		res = syncDeletePlan(ctx, tx, m, changedAt)
+	default:
+		return rejected("unknown mutation type")
+	}
+	if res.Status == "rejected" || len(res.Applied) == 0 {
+		return res
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return rejected("commit failed")
+	}
+
+	if m.Type == "day" {
+		done := false
+		for _, f := range res.Applied {
+			switch f {
+			case "is_done":
+				_ = json.Unmarshal(m.Fields["is_done"], &done)
+			case "status":
+				var st string
+				_ = json.Unmarshal(m.Fields["status"], &st)
+				done = dayCountsDone(st)
+			}
+		}
+		if done {
+			recordDayDoneEvent(ctx, db, uid, m.PlanID, m.DayNumber)
+		}
+	}
+
+	ev := realtime.Event{PlanID: m.PlanID, ActorID: uid.String()}
+	switch m.Type {
+	case "plan":
+		ev.Type = "plan.updated"
+	case "day":
+		ev.Type = "day.updated"
+		ev.DayNumber = &m.DayNumber
+	case "completion":
+		ev.Type = "completion.updated"
+		ev.DayNumber = &m.DayNumber
+	case "delete_plan":
+		ev.Type = "plan.deleted"
+	}
+	publishPlanEvent(ctx, db, hub, ev)
+	return res
+}
+
+// syncWriteFields applies the plan or day fields whose client timestamp is
+// newer than the stored per-field write time.
+func syncWriteFields(ctx context.Context, tx pgx.Tx, uid uuid.UUID, m SyncMutation, changedAt time.Time, allowed map[string]syncField) SyncResult {
+	if len(m.Fields) == 0 {
+		return rejected("no fields")
+	}
+
+	isDay := m.Type == "day"
+	var fieldTimes map[string]time.Time
+	var updatedAt time.Time
+	var err error
+	if isDay {
+		err = tx.QueryRow(ctx, `
+			select field_times, updated_at from public.plan_days
+			where plan_id = $1 and day_number = $2
+			for update
+		`, m.PlanID, m.DayNumber).Scan(&fieldTimes, &updatedAt)
+	} else {
+		err = tx.QueryRow(ctx, `
+			select field_times, updated_at from public.plans
+			where id = $1
+			for update
+		`, m.PlanID).Scan(&fieldTimes, &updatedAt)
+	}
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return rejected("not found")
+		}
+		return rejected("load failed")
+	}
+
+	var before any
+	if isDay {
+		before, err = snapshotDay(ctx, tx, m.PlanID, m.DayNumber)
+	} else {
+		before, err = snapshotPlan(ctx, tx, m.PlanID)
+	}
+	if err != nil {
+		return rejected("snapshot failed")
+	}
+
+	// Each applied field sets its column and nests one more jsonb_set
+	// around field_times with the client's timestamp.
+	res := SyncResult{}
+	sets := make([]string, 0, len(m.Fields)+1)
+	times := "field_times"
+	args := []any{m.PlanID}
+	if isDay {
+		args = append(args, m.DayNumber)
+	}
+	for name, raw := range m.Fields {
+		f, ok := allowed[name]
+		if !ok {
+			return rejected("unknown field " + name)
+		}
+		val, err := f.decode(raw)
+		if err != nil {
+			return rejected(name + " " + err.Error())
+		}
+
+		stored, ok := fieldTimes[name]
+		if !ok {
+			stored = updatedAt
+		}
+		if !changedAt.After(stored) {
+			res.Stale = append(res.Stale, name)
+			continue
+		}
+
+		args = append(args, val)
+		sets = append(sets, fmt.Sprintf("%s = $%d", f.column, len(args)))
+		args = append(args, changedAt)
+		times = fmt.Sprintf("jsonb_set(%s, '{%s}', to_jsonb($%d::timestamptz))", times, f.column, len(args))
+		res.Applied = append(res.Applied, name)
+	}
+
+	if len(res.Applied) == 0 {
+		res.Status = "stale"
+		return res
+	}
+
+	sets = append(sets, "field_times = "+times)
+	sql := "update public.plans set " + strings.Join(sets, ", ") + " where id = $1"
+	if isDay {
+		sql = "update public.plan_days set " + strings.Join(sets, ", ") +
+			" where plan_id = $1 and day_number = $2"
+	}
+	if _, err := tx.Exec(ctx, sql, args...); err != nil {
+		log.Printf("sync update failed: %v", err)
+		return rejected("update failed")
+	}
+
+	if isDay {
+		err = recordDayChange(ctx, tx, m.PlanID, m.DayNumber, uid, "sync", before.(*dayState))
+	} else {
+		var after *planState
+		after, err = snapshotPlan(ctx, tx, m.PlanID)
+		if err == nil {
+			err = recordRevision(ctx, tx, m.PlanID, nil, uid, "sync", before, after)
+		}
+	}
+	if err != nil {
+		return rejected("record revision failed")
+	}
+	if isDay {
+		if _, err := refreshPlanCompletion(ctx, tx, m.PlanID); err != nil {
+			return rejected("update status failed")
+		}
+	}
+	if _, err := touchPlan(ctx, tx, m.PlanID); err != nil {
+		return rejected("bump version failed")
+	}
+
+	res.Status = "applied"
+	if len(res.Stale) > 0 {
+		res.Status = "partial"
+	}
+	return res
+}
+
+func syncWriteCompletion(ctx context.Context, tx pgx.Tx, uid uuid.UUID, m SyncMutation, changedAt time.Time) SyncResult {
+	raw, ok := m.Fields["is_done"]
+	if !ok || len(m.Fields) != 1 {
+		return rejected("completion takes only is_done")
+	}
+	val, err := decodeBool(raw)
+	if err != nil {
+		return rejected("is_done " + err.Error())
+	}
+	if m.DayNumber <= 0 {
+		return rejected("invalid day_number")
+	}
+
+	tag, err := tx.Exec(ctx, `
+		insert into public.plan_member_days (plan_id, day_number, user_id, is_done, updated_at)
+		select d.plan_id, d.day_number, $3, $4, $5
+		from public.plan_days d
+		where d.plan_id = $1 and d.day_number = $2
+		on conflict (plan_id, day_number, user_id) do update
+		  set is_done = excluded.is_done, updated_at = excluded.updated_at
+		  where plan_member_days.updated_at < excluded.updated_at
+	`, m.PlanID, m.DayNumber, uid, val, changedAt)
+	if err != nil {
+		return rejected("update failed")
+	}
+	if tag.RowsAffected() == 0 {
+		var exists bool
+		_ = tx.QueryRow(ctx, `
+			select exists (select 1 from public.plan_days where plan_id = $1 and day_number = $2)
+		`, m.PlanID, m.DayNumber).Scan(&exists)
+		if !exists {
+			return rejected("not found")
+		}
+		return SyncResult{Status: "stale", Stale: []string{"is_done"}}
+	}
+	return SyncResult{Status: "applied", Applied: []string{"is_done"}}
+}
+
+// syncDeletePlan moves the plan to the trash unless it was written after
+// the client decided to delete it; in that case the newer edit wins.
+func syncDeletePlan(ctx context.Context, tx pgx.Tx, m SyncMutation, changedAt time.Time) SyncResult {
+	var updatedAt time.Time
+	err := tx.QueryRow(ctx, `
+		select updated_at from public.plans where id = $1 for update
+	`, m.PlanID).Scan(&updatedAt)
+	if err != nil {
+		return rejected("not found")
+	}
+	if !changedAt.After(updatedAt) {
+		return SyncResult{Status: "stale", Stale: []string{"plan"}}
+	}
+	if err := trashPlan(ctx, tx, m.PlanID); err != nil {
+		return rejected("delete failed")
+	}
+	return SyncResult{Status: "applied", Applied: []string{"plan"}}
+}
@@ -0,0 +1,133 @@
+package httpapi
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// testDB connects to TEST_DATABASE_URL, a database with every migration
+// applied. Tests that need Postgres are skipped without it.
+func testDB(t *testing.T) *pgxpool.Pool {
+	t.Helper()
+	url := os.Getenv("TEST_DATABASE_URL")
+	if url == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+	db, err := pgxpool.New(context.Background(), url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(db.Close)
+	return db
+}
+
+func TestParseSyncCursor(t *testing.T) {
+	cases := []struct {
+		in      string
+		want    uint64
+		wantErr bool
+	}{
+		{"", 0, false},
+		{"x42", 42, false},
+		{"17", 0, false}, // pre-xid cursor: full pull
+		{"x", 0, true},
+		{"x-1", 0, true},
+		{"abc", 0, true},
+	}
+	for _, c := range cases {
+		got, err := parseSyncCursor(c.in)
+		if (err != nil) != c.wantErr || got != c.want {
+			t.Errorf("parseSyncCursor(%q) = %d, %v; want %d, err %v", c.in, got, err, c.want, c.wantErr)
+		}
+	}
+}
+
+// A writer that takes its change_seq first but commits last must still
+// reach a client whose cursor was handed out in between.
+func TestSyncCursorOutOfOrderCommits(t *testing.T) {
+	db := testDB(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	uid := uuid.New()
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	planID, _, err := insertPlan(ctx, tx, uid, newPlan{
+		Title: "sync order", Days: 2, DailyMinutes: 30,
+		Items: []PlanDay{{DayNumber: 1, Steps: []PlanDayStep{}}, {DayNumber: 2, Steps: []PlanDayStep{}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(ctx); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		_, _ = db.Exec(context.Background(), `delete from public.plans where id = $1`, planID)
+		_, _ = db.Exec(context.Background(), `delete from public.users where id = $1`, uid)
+	})
+
+	first, err := loadSyncChanges(ctx, db, uid, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cursor, err := parseSyncCursor(first.Cursor)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Writer A stamps day 1 first, writer B stamps day 2 and commits.
+	a, err := db.Begin(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = a.Rollback(ctx) }()
+	if _, err := a.Exec(ctx, `update public.plan_days set focus = 'a' where plan_id = $1 and day_number = 1`, planID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(ctx, `update public.plan_days set focus = 'b' where plan_id = $1 and day_number = 2`, planID); err != nil {
+		t.Fatal(err)
+	}
+
+	mid, err := loadSyncChanges(ctx, db, uid, cursor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if focus := syncDayFocus(mid, 2); focus != "b" {
+		t.Fatalf("day 2 focus after B = %q, want b", focus)
+	}
+	if focus := syncDayFocus(mid, 1); focus == "a" {
+		t.Fatal("uncommitted write visible")
+	}
+
+	if err := a.Commit(ctx); err != nil {
+		t.Fatal(err)
+	}
+	cursor, err = parseSyncCursor(mid.Cursor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	last, err := loadSyncChanges(ctx, db, uid, cursor)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if focus := syncDayFocus(last, 1); focus != "a" {
+		t.Fatalf("day 1 focus after A commits = %q, want a (change skipped)", focus)
+	}
+}
+
+func syncDayFocus(resp SyncResponse, day int) string {
+	for _, d := range resp.Days {
+		if d.DayNumber == day {
+			return d.Focus
+		}
+	}
+	return ""
+}
@@ -0,0 +1,431 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const maxTagName = 40
+
+var tagColorRe = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+type Tag struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Color     string    `json:"color"`
+	Plans     int       `json:"plans"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// TagRef is how a tag appears on a plan list item.
+type TagRef struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Color string `json:"color"`
+}
+
+type TagRequest struct {
+	Name  *string `json:"name"`
+	Color *string `json:"color"`
+}
+
+type TagStats struct {
+	TagRef
+	Plans     int `json:"plans"`
+	Active    int `json:"active"`
+	Paused    int `json:"paused"`
+	Archived  int `json:"archived"`
+	Completed int `json:"completed"`
+	DaysDone  int `json:"days_done"`
+	// DaysBad are the done days that were bad days; DaysSkipped counts skips.
+	DaysBad     int `json:"days_bad"`
+	DaysSkipped int `json:"days_skipped"`
+	DaysTotal   int `json:"days_total"`
+}
+
+// validateTagRequest trims and checks whichever fields are set.
+func validateTagRequest(req *TagRequest) string {
+	if req.Name != nil {
+		n := strings.TrimSpace(*req.Name)
+		if n == "" || len([]rune(n)) > maxTagName {
+			return "name must be 1-40 characters"
+		}
+		req.Name = &n
+	}
+	if req.Color != nil && !tagColorRe.MatchString(*req.Color) {
+		return "color must look like #RRGGBB"
+	}
+	return ""
+}
+
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "23505"
+}
+
+// tagOwnedBy reports whether tagID is one of uid's tags.
+func tagOwnedBy(ctx context.Context, q querier, tagID string, uid uuid.UUID) (bool, error) {
+	if _, err := uuid.Parse(tagID); err != nil {
+		return false, nil
+	}
+	var ok bool
+	err := q.QueryRow(ctx, `
+		select exists (select 1 from public.tags where id = $1 and user_id = $2)
+	`, tagID, uid).Scan(&ok)
+	return ok, err
+}
+
+// handleListTags: GET /tags with the number of (untrashed) plans on each.
+func handleListTags(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if db == nil {
+			httpError(w, "db not connected", http.StatusServiceUnavailable)
+			return
+		}
+		uid, ok := userIDFromCtx(r.Context())
+		if !ok {
+			httpError(w, "missing user", http.StatusUnauthorized)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 8*time.Second)
+		defer cancel()
+
+		rows, err := db.Query(ctx, `
+			select t.id, t.name, t.color, t.created_at,
+			       (select count(*) from public.plan_tags pt
+			        join public.plans p on p.id = pt.plan_id
+			        join public.plan_members m on m.plan_id = p.id and m.user_id = $1
+			        where pt.tag_id = t.id and p.deleted_at is null)
+			from public.tags t
+			where t.user_id = $1
+			order by lower(t.name)
+		`, uid)
+		if err != nil {
+			internalError(w, "query failed", err)
+			return
+		}
+		defer rows.Close()
+
+		out := make([]Tag, 0)
+		for rows.Next() {
+			var t Tag
+			if err := rows.Scan(&t.ID, &t.Name, &t.Color, &t.CreatedAt, &t.Plans); err != nil {
+				internalError(w, "scan failed", err)
+				return
+			}
+			out = append(out, t)
+		}
+		if err := rows.Err(); err != nil {
+			internalError(w, "rows failed", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{"tags": out})
+	}
+}
+
+func handleCreateTag(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if db == nil {
+			httpError(w, "db not connected", http.StatusServiceUnavailable)
+			return
+		}
+		uid, ok := userIDFromCtx(r.Context())
+		if !ok {
+			httpError(w, "missing user", http.StatusUnauthorized)
+			return
+		}
+
+		var req TagRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			httpError(w, "invalid json body", http.StatusBadRequest)
+			return
+		}
+		if req.Name == nil {
+			httpError(w, "missing name", http.StatusBadRequest)
+			return
+		}
+		if msg := validateTagRequest(&req); msg != "" {
+			httpError(w, msg, http.StatusBadRequest)
+			return
+		}
+		color := "#888888"
+		if req.Color != nil {
+			color = *req.Color
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 8*time.Second)
+		defer cancel()
+
+		t := Tag{Name: *req.Name, Color: color}
+		err := db.QueryRow(ctx, `
+			insert into public.tags (user_id, name, color)
+			values ($1, $2, $3)
+			returning id, created_at
+		`, uid, t.Name, t.Color).Scan(&t.ID, &t.CreatedAt)
+		if err != nil {
+			if isUniqueViolation(err) {
+				httpError(w, "tag already exists", http.StatusConflict)
+				return
+			}
+			internalError(w, "insert failed", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(t)
+	}
+}
+
+// handleUpdateTag: PATCH /tags/{tagId} renames or recolors a tag.
+func handleUpdateTag(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if db == nil {
+			httpError(w, "db not connected", http.StatusServiceUnavailable)
+			return
+		}
+		uid, ok := userIDFromCtx(r.Context())
+		if !ok {
+			httpError(w, "missing user", http.StatusUnauthorized)
+			return
+		}
+
+		tagID := chi.URLParam(r, "tagId")
+		if _, err := uuid.Parse(tagID); err != nil {
+			httpError(w, "tag not found", http.StatusNotFound)
+			return
+		}
+
+		var req TagRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			httpError(w, "invalid json body", http.StatusBadRequest)
+			return
+		}
+		if req.Name == nil && req.Color == nil {
+			httpError(w, "nothing to update", http.StatusBadRequest)
+			return
+		}
+		if msg := validateTagRequest(&req); msg != "" {
+			httpError(w, msg, http.StatusBadRequest)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 8*time.Second)
+		defer cancel()
+
+		var t Tag
+		err := db.QueryRow(ctx, `
+			update public.tags
+			set name = coalesce($3, name), color = coalesce($4, color)
+			where id = $1 and user_id = $2
+			returning id, name, color, created_at
+		`, tagID, uid, req.Name, req.Color).Scan(&t.ID, &t.Name, &t.Color, &t.CreatedAt)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				httpError(w, "tag not found", http.StatusNotFound)
+				return
+			}
+			if isUniqueViolation(err) {
+				httpError(w, "tag already exists", http.StatusConflict)
+				return
+			}
+			internalError(w, "update failed", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(t)
+	}
+}
+
+// handleDeleteTag removes the tag from every plan it was on.
+func handleDeleteTag(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if db == nil {
+			httpError(w, "db not connected", http.StatusServiceUnavailable)
+			return
+		}
+		uid, ok := userIDFromCtx(r.Context())
+		if !ok {
+			httpError(w, "missing user", http.StatusUnauthorized)
+			return
+		}
+
+		tagID := chi.URLParam(r, "tagId")
+		if _, err := uuid.Parse(tagID); err != nil {
+			httpError(w, "tag not found", http.StatusNotFound)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 8*time.Second)
+		defer cancel()
+
+		tag, err := db.Exec(ctx, `
+			delete from public.tags where id = $1 and user_id = $2
+		`, tagID, uid)
+		if err != nil {
+			internalError(w, "delete failed", err)
+			return
+		}
+		if tag.RowsAffected() == 0 {
+			httpError(w, "tag not found", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{"ok": true, "tag_id": tagID})
+	}
+}
+
+// handleTagPlan: PUT /plans/{id}/tags/{tagId} attaches one of the caller's
+// tags to a plan they can see. Re-attaching is a no-op.
+func handleTagPlan(db *pgxpool.Pool) http.HandlerFunc {
+	return handlePlanTagChange(db, true)
+}
+
+// handleUntagPlan: DELETE /plans/{id}/tags/{tagId}.
+func handleUntagPlan(db *pgxpool.Pool) http.HandlerFunc {
+	return handlePlanTagChange(db, false)
+}
+
+func handlePlanTagChange(db *pgxpool.Pool, attach bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if db == nil {
+			httpError(w, "db not connected", http.StatusServiceUnavailable)
+			return
+		}
+		uid, ok := userIDFromCtx(r.Context())
+		if !ok {
+			httpError(w, "missing user", http.StatusUnauthorized)
+			return
+		}
+
+		planID := chi.URLParam(r, "id")
+		tagID := chi.URLParam(r, "tagId")
+
+		ctx, cancel := context.WithTimeout(r.Context(), 8*time.Second)
+		defer cancel()
+
+		// Tags are personal labels, so any member may tag a plan.
+		if _, ok := requirePlanRole(ctx, w, db, planID, uid, roleViewer); !ok {
+			return
+		}
+		owned, err := tagOwnedBy(ctx, db, tagID, uid)
+		if err != nil {
+			internalError(w, "query failed", err)
+			return
+		}
+		if !owned {
+			httpError(w, "tag not found", http.StatusNotFound)
+			return
+		}
+
+		if attach {
+			_, err = db.Exec(ctx, `
+				insert into public.plan_tags (tag_id, plan_id) values ($1, $2)
+				on conflict do nothing
+			`, tagID, planID)
+		} else {
+			_, err = db.Exec(ctx, `
+				delete from public.plan_tags where tag_id = $1 and plan_id = $2
+			`, tagID, planID)
+		}
+		if err != nil {
+			internalError(w, "update failed", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"ok":      true,
+			"plan_id": planID,
+			"tag_id":  tagID,
+			"tagged":  attach,
+		})
+	}
+}
+
+// handleTagStats: GET /stats/tags rolls the caller's plans up per tag.
+// Trashed plans, and shared plans the caller has left, are not counted.
+func handleTagStats(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if db == nil {
+			httpError(w, "db not connected", http.StatusServiceUnavailable)
+			return
+		}
+		uid, ok := userIDFromCtx(r.Context())
+		if !ok {
+			httpError(w, "missing user", http.StatusUnauthorized)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 8*time.Second)
+		defer cancel()
+
+		rows, err := db.Query(ctx, `
+			select t.id, t.name, t.color,
+			       count(p.id),
+			       count(p.id) filter (where p.status = 'active'),
+			       count(p.id) filter (where p.status = 'paused'),
+			       count(p.id) filter (where p.status = 'archived'),
+			       count(p.id) filter (where p.status = 'completed'),
+			       coalesce(sum(prog.done), 0),
+			       coalesce(sum(prog.bad), 0),
+			       coalesce(sum(prog.skips), 0),
+			       coalesce(sum(prog.total), 0)
+			from public.tags t
+			left join public.plan_tags pt on pt.tag_id = t.id
+			left join (public.plans p
+				join public.plan_members m on m.plan_id = p.id and m.user_id = $1
+			) on p.id = pt.plan_id and p.deleted_at is null
+			left join lateral (
+				select count(*) filter (where d.is_done) as done,
+				       count(*) filter (where d.status = 'bad_day') as bad,
+				       coalesce(sum(d.skip_count), 0) as skips,
+				       count(*) as total
+				from public.plan_days d
+				where d.plan_id = p.id
+			) prog on true
+			where t.user_id = $1
+			group by t.id, t.name, t.color
+			order by lower(t.name)
+		`, uid)
+		if err != nil {
+			internalError(w, "query failed", err)
+			return
+		}
+		defer rows.Close()
+
+		out := make([]TagStats, 0)
+		for rows.Next() {
+			var s TagStats
+			if err := rows.Scan(&s.ID, &s.Name, &s.Color, &s.Plans, &s.Active, &s.Paused,
+				&s.Archived, &s.Completed, &s.DaysDone, &s.DaysBad, &s.DaysSkipped, &s.DaysTotal); err != nil {
+				internalError(w, "scan failed", err)
+				return
+			}
+			out = append(out, s)
+		}
+		if err := rows.Err(); err != nil {
+			internalError(w, "rows failed", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{"tags": out})
+	}
+}
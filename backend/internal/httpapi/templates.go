@@ -0,0 +1,428 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Same enum the splitter schema uses for meta.goal_type.
+var goalTypes = map[string]bool{
+	"Learn": true, "Build": true, "Create": true,
+	"Improve": true, "Organize": true, "Social": true,
+}
+
+// TemplateStep keeps minutes relative to the source plan's daily minutes
+// (0.5 = half the day), so a template fits any new budget.
+type TemplateStep struct {
+	Title        string  `json:"title"`
+	MinutesShare float64 `json:"minutes_share"`
+	Deliverable  string  `json:"deliverable"`
+	DoneDef      string  `json:"done_definition"`
+}
+
+type TemplateDay struct {
+	DayNumber int            `json:"day_number"`
+	Focus     string         `json:"focus"`
+	Steps     []TemplateStep `json:"steps"`
+}
+
+type PlanTemplate struct {
+	ID           string        `json:"id"`
+	SourcePlanID *string       `json:"source_plan_id"`
+	Title        string        `json:"title"`
+	GoalType     string        `json:"goal_type"`
+	Days         int           `json:"days"`
+	CreatedAt    time.Time     `json:"created_at"`
+	Items        []TemplateDay `json:"items,omitempty"`
+}
+
+type SaveTemplateRequest struct {
+	Title    string `json:"title,omitempty"`
+	GoalType string `json:"goal_type,omitempty"`
+}
+
+type PlanFromTemplateRequest struct {
+	Title        string `json:"title,omitempty"`
+	DailyMinutes int    `json:"daily_minutes"`
+}
+
+// templateFromDays turns concrete minutes into shares of dailyMinutes.
+func templateFromDays(days []PlanDay, dailyMinutes int) []TemplateDay {
+	out := make([]TemplateDay, 0, len(days))
+	for _, d := range days {
+		td := TemplateDay{DayNumber: d.DayNumber, Focus: d.Focus, Steps: make([]TemplateStep, 0, len(d.Steps))}
+		for _, s := range d.Steps {
+			share := 0.0
+			if dailyMinutes > 0 {
+				share = math.Round(float64(s.Minutes)/float64(dailyMinutes)*1000) / 1000
+			}
+			td.Steps = append(td.Steps, TemplateStep{
+				Title:        s.Title,
+				MinutesShare: share,
+				Deliverable:  s.Deliverable,
+				DoneDef:      s.DoneDef,
+			})
+		}
+		out = append(out, td)
+	}
+	return out
+}
+
+// daysFromTemplate builds fresh (undone) days for a new daily budget.
+// Shares only act as weights; rebalanceSteps applies the splitter's
+// CORE/MOMENTUM/BAD DAY rule for the standard 3-step day.
+func daysFromTemplate(items []TemplateDay, dailyMinutes int) []PlanDay {
+	out := make([]PlanDay, 0, len(items))
+	for i, td := range items {
+		steps := make([]PlanDayStep, 0, len(td.Steps))
+		for _, s := range td.Steps {
+			steps = append(steps, PlanDayStep{
+				Title:       s.Title,
+				Minutes:     int(math.Round(s.MinutesShare * 1000)),
+				Deliverable: s.Deliverable,
+				DoneDef:     s.DoneDef,
+			})
+		}
+		out = append(out, PlanDay{
+			DayNumber: i + 1,
+			Focus:     td.Focus,
+			Steps:     rebalanceSteps(steps, dailyMinutes),
+		})
+	}
+	return out
+}
+
+// handleSaveTemplate snapshots a plan (any member may do this) into the
+// caller's template library.
+func handleSaveTemplate(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if db == nil {
+			httpError(w, "db not connected", http.StatusServiceUnavailable)
+			return
+		}
+		uid, ok := userIDFromCtx(r.Context())
+		if !ok {
+			httpError(w, "missing user", http.StatusUnauthorized)
+			return
+		}
+
+		planID := chi.URLParam(r, "id")
+
+		var req SaveTemplateRequest
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				httpError(w, "invalid json body", http.StatusBadRequest)
+				return
+			}
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+
+		if _, ok := requirePlanRole(ctx, w, db, planID, uid, roleViewer); !ok {
+			return
+		}
+
+		var title, goalType string
+		var days, dailyMinutes int
+		err := db.QueryRow(ctx, `
+			select title, coalesce(goal_type, ''), days, daily_minutes
+			from public.plans where id = $1
+		`, planID).Scan(&title, &goalType, &days, &dailyMinutes)
+		if err != nil {
+			httpError(w, "plan not found", http.StatusNotFound)
+			return
+		}
+
+		if t := strings.TrimSpace(req.Title); t != "" {
+			title = t
+		}
+		if req.GoalType != "" {
+			goalType = req.GoalType
+		}
+		if !goalTypes[goalType] {
+			httpError(w, "goal_type must be one of Learn, Build, Create, Improve, Organize, Social", http.StatusBadRequest)
+			return
+		}
+
+		items, err := loadPlanDays(ctx, db, planID)
+		if err != nil {
+			internalError(w, "query plan_days failed", err)
+			return
+		}
+		if len(items) == 0 {
+			httpError(w, "plan has no days", http.StatusBadRequest)
+			return
+		}
+
+		tpl := PlanTemplate{
+			SourcePlanID: &planID,
+			Title:        title,
+			GoalType:     goalType,
+			Days:         len(items),
+			Items:        templateFromDays(items, dailyMinutes),
+		}
+		itemsJSON, _ := json.Marshal(tpl.Items)
+
+		err = db.QueryRow(ctx, `
+			insert into public.plan_templates
+			  (user_id, source_plan_id, title, goal_type, days, source_daily_minutes, items)
+			values ($1, $2, $3, $4, $5, $6, $7)
+			returning id, created_at
+		`, uid, planID, tpl.Title, tpl.GoalType, tpl.Days, dailyMinutes, itemsJSON).Scan(&tpl.ID, &tpl.CreatedAt)
+		if err != nil {
+			internalError(w, "save template failed", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(tpl)
+	}
+}
+
+// handleListTemplates lists the caller's templates.
+// ?goal_type= filters exactly, ?q= matches the title (case-insensitive).
+func handleListTemplates(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if db == nil {
+			httpError(w, "db not connected", http.StatusServiceUnavailable)
+			return
+		}
+		uid, ok := userIDFromCtx(r.Context())
+		if !ok {
+			httpError(w, "missing user", http.StatusUnauthorized)
+			return
+		}
+
+		goalType := r.URL.Query().Get("goal_type")
+		if goalType != "" && !goalTypes[goalType] {
+			httpError(w, "invalid goal_type", http.StatusBadRequest)
+			return
+		}
+		q := strings.TrimSpace(r.URL.Query().Get("q"))
+
+		ctx, cancel := context.WithTimeout(r.Context(), 8*time.Second)
+		defer cancel()
+
+		rows, err := db.Query(ctx, `
+			select id, source_plan_id, title, goal_type, days, created_at
+			from public.plan_templates
+			where user_id = $1
+			  and ($2 = '' or goal_type = $2)
+			  and ($3 = '' or title ilike '%' || $3 || '%' escape '\')
+			order by created_at desc
+			limit 100
+		`, uid, goalType, escapeLike(q))
+		if err != nil {
+			internalError(w, "query failed", err)
+			return
+		}
+		defer rows.Close()
+
+		out := make([]PlanTemplate, 0)
+		for rows.Next() {
+			var t PlanTemplate
+			if err := rows.Scan(&t.ID, &t.SourcePlanID, &t.Title, &t.GoalType, &t.Days, &t.CreatedAt); err != nil {
+				internalError(w, "scan failed", err)
+				return
+			}
+			out = append(out, t)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{"templates": out})
+	}
+}
+
+// loadTemplate reads one of uid's templates including its days.
+func loadTemplate(ctx context.Context, q querier, templateID string, uid uuid.UUID) (PlanTemplate, error) {
+	var t PlanTemplate
+	if _, err := uuid.Parse(templateID); err != nil {
+		return t, pgx.ErrNoRows
+	}
+	var itemsRaw []byte
+	err := q.QueryRow(ctx, `
+		select id, source_plan_id, title, goal_type, days, created_at, items
+		from public.plan_templates
+		where id = $1 and user_id = $2
+	`, templateID, uid).Scan(&t.ID, &t.SourcePlanID, &t.Title, &t.GoalType, &t.Days, &t.CreatedAt, &itemsRaw)
+	if err != nil {
+		return t, err
+	}
+	if err := json.Unmarshal(itemsRaw, &t.Items); err != nil {
+		return t, err
+	}
+	return t, nil
+}
+
+func handleGetTemplate(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if db == nil {
+			httpError(w, "db not connected", http.StatusServiceUnavailable)
+			return
+		}
+		uid, ok := userIDFromCtx(r.Context())
+		if !ok {
+			httpError(w, "missing user", http.StatusUnauthorized)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 8*time.Second)
+		defer cancel()
+
+		tpl, err := loadTemplate(ctx, db, chi.URLParam(r, "templateId"), uid)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				httpError(w, "template not found", http.StatusNotFound)
+				return
+			}
+			internalError(w, "query failed", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(tpl)
+	}
+}
+
+func handleDeleteTemplate(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if db == nil {
+			httpError(w, "db not connected", http.StatusServiceUnavailable)
+			return
+		}
+		uid, ok := userIDFromCtx(r.Context())
+		if !ok {
+			httpError(w, "missing user", http.StatusUnauthorized)
+			return
+		}
+
+		templateID := chi.URLParam(r, "templateId")
+		if _, err := uuid.Parse(templateID); err != nil {
+			httpError(w, "template not found", http.StatusNotFound)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 8*time.Second)
+		defer cancel()
+
+		tag, err := db.Exec(ctx, `
+			delete from public.plan_templates
+			where id = $1 and user_id = $2
+		`, templateID, uid)
+		if err != nil {
+			internalError(w, "delete failed", err)
+			return
+		}
+		if tag.RowsAffected() == 0 {
+			httpError(w, "template not found", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"ok":          true,
+			"template_id": templateID,
+		})
+	}
+}
+
+// handleCreatePlanFromTemplate creates a plan from a template with a new
+// daily budget. No AI call: steps are rescaled locally.
+func handleCreatePlanFromTemplate(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if db == nil {
+			httpError(w, "db not connected", http.StatusServiceUnavailable)
+			return
+		}
+		uid, ok := userIDFromCtx(r.Context())
+		if !ok {
+			httpError(w, "missing user", http.StatusUnauthorized)
+			return
+		}
+
+		var req PlanFromTemplateRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			httpError(w, "invalid json body", http.StatusBadRequest)
+			return
+		}
+		if req.DailyMinutes <= 0 || req.DailyMinutes > 24*60 {
+			httpError(w, "invalid daily_minutes", http.StatusBadRequest)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+
+		tpl, err := loadTemplate(ctx, db, chi.URLParam(r, "templateId"), uid)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				httpError(w, "template not found", http.StatusNotFound)
+				return
+			}
+			internalError(w, "query failed", err)
+			return
+		}
+
+		title := strings.TrimSpace(req.Title)
+		if title == "" {
+			title = tpl.Title
+		}
+		items := daysFromTemplate(tpl.Items, req.DailyMinutes)
+
+		tx, err := db.Begin(ctx)
+		if err != nil {
+			internalError(w, "begin tx failed", err)
+			return
+		}
+		defer func() { _ = tx.Rollback(ctx) }()
+
+		planID, createdAt, err := insertPlan(ctx, tx, uid, newPlan{
+			Title:        title,
+			Days:         len(items),
+			DailyMinutes: req.DailyMinutes,
+			GoalType:     tpl.GoalType,
+			Items:        items,
+		})
+		if err != nil {
+			internalError(w, "insert plan failed", err)
+			return
+		}
+		if err := tx.Commit(ctx); err != nil {
+			internalError(w, "commit failed", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(PlanDetailResponse{
+			ID:           planID,
+			Title:        title,
+			Days:         len(items),
+			DailyMinutes: req.DailyMinutes,
+			GoalType:     tpl.GoalType,
+			CreatedAt:    createdAt,
+			Role:         string(roleOwner),
+			Items:        items,
+		})
+	}
+}
+
+// escapeLike escapes the ilike wildcards in s so a search for "50%" or
+// "a_b" matches those characters literally. Pair it with escape '\'.
+func escapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
@@ -0,0 +1,196 @@
+package httpapi
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"sliceapp-backend/internal/config"
+	"sliceapp-backend/internal/realtime"
+)
+
+type TrashItem struct {
+	ID           string    `json:"id"`
+	Title        string    `json:"title"`
+	Days         int       `json:"days"`
+	DailyMinutes int       `json:"daily_minutes"`
+	GoalType     string    `json:"goal_type,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+	DeletedAt    time.Time `json:"deleted_at"`
+	PurgeAt      time.Time `json:"purge_at"`
+}
+
+// trashPlan soft-deletes planID. Trashed plans are invisible to
+// planRoleFor, so every member-facing endpoint treats them as gone.
+func trashPlan(ctx context.Context, q querier, planID string) error {
+	_, err := q.Exec(ctx, `
+		update public.plans set deleted_at = now()
+		where id = $1 and deleted_at is null
+	`, planID)
+	return err
+}
+
+// handleListTrash: GET /trash lists the caller's own trashed plans,
+// newest first, with the time each will be purged.
+func handleListTrash(db *pgxpool.Pool, cfg config.Config) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if db == nil {
+			httpError(w, "db not connected", http.StatusServiceUnavailable)
+			return
+		}
+		uid, ok := userIDFromCtx(r.Context())
+		if !ok {
+			httpError(w, "missing user", http.StatusUnauthorized)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 8*time.Second)
+		defer cancel()
+
+		rows, err := db.Query(ctx, `
+			select p.id, p.title, p.days, p.daily_minutes, coalesce(p.goal_type, ''),
+			       p.created_at, p.deleted_at
+			from public.plans p
+			join public.plan_members m on m.plan_id = p.id
+			where m.user_id = $1 and m.role = 'owner' and p.deleted_at is not null
+			order by p.deleted_at desc
+			limit 100
+		`, uid)
+		if err != nil {
+			internalError(w, "query failed", err)
+			return
+		}
+		defer rows.Close()
+
+		retention := time.Duration(cfg.TrashRetentionDays) * 24 * time.Hour
+		out := make([]TrashItem, 0)
+		for rows.Next() {
+			var it TrashItem
+			if err := rows.Scan(&it.ID, &it.Title, &it.Days, &it.DailyMinutes, &it.GoalType, &it.CreatedAt, &it.DeletedAt); err != nil {
+				internalError(w, "scan failed", err)
+				return
+			}
+			it.PurgeAt = it.DeletedAt.Add(retention)
+			out = append(out, it)
+		}
+		if err := rows.Err(); err != nil {
+			internalError(w, "rows error", err)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{"plans": out})
+	}
+}
+
+// handleRestorePlan: POST /plans/{id}/restore takes a plan out of the
+// trash. Owner only.
+func handleRestorePlan(db *pgxpool.Pool, hub *realtime.Broker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if db == nil {
+			httpError(w, "db not connected", http.StatusServiceUnavailable)
+			return
+		}
+		uid, ok := userIDFromCtx(r.Context())
+		if !ok {
+			httpError(w, "missing user", http.StatusUnauthorized)
+			return
+		}
+
+		planID := chi.URLParam(r, "id")
+		if _, err := uuid.Parse(planID); err != nil {
+			httpError(w, "plan not found", http.StatusNotFound)
+			return
+		}
+
+		ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+		defer cancel()
+
+		tx, err := db.Begin(ctx)
+		if err != nil {
+			internalError(w, "begin tx failed", err)
+			return
+		}
+		defer func() { _ = tx.Rollback(ctx) }()
+
+		// planRoleFor hides trashed plans, so look the role up directly.
+		var role string
+		var deletedAt *time.Time
+		err = tx.QueryRow(ctx, `
+			select m.role, p.deleted_at
+			from public.plan_members m
+			join public.plans p on p.id = m.plan_id
+			where m.plan_id = $1 and m.user_id = $2
+			for update of p
+		`, planID, uid).Scan(&role, &deletedAt)
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				httpError(w, "plan not found", http.StatusNotFound)
+				return
+			}
+			internalError(w, "query failed", err)
+			return
+		}
+		if planRole(role) != roleOwner {
+			httpError(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		if deletedAt == nil {
+			httpError(w, "plan is not in the trash", http.StatusConflict)
+			return
+		}
+
+		if _, err := tx.Exec(ctx, `
+			update public.plans set deleted_at = null where id = $1
+		`, planID); err != nil {
+			internalError(w, "restore failed", err)
+			return
+		}
+		// Sync clients dropped this plan's rows when it was trashed; bump
+		// them past their cursor so the next pull sends them again.
+		if _, err := tx.Exec(ctx, `
+			update public.plan_days set day_number = day_number where plan_id = $1
+		`, planID); err != nil {
+			internalError(w, "restore failed", err)
+			return
+		}
+		if _, err := tx.Exec(ctx, `
+			update public.plan_member_days set day_number = day_number where plan_id = $1
+		`, planID); err != nil {
+			internalError(w, "restore failed", err)
+			return
+		}
+		version, err := touchPlan(ctx, tx, planID)
+		if err != nil {
+			internalError(w, "bump version failed", err)
+			return
+		}
+
+		resp, err := loadPlanDetail(ctx, tx, planID)
+		if err != nil {
+			internalError(w, "load plan failed", err)
+			return
+		}
+		resp.Role = string(roleOwner)
+
+		if err := tx.Commit(ctx); err != nil {
+			internalError(w, "commit failed", err)
+			return
+		}
+
+		publishPlanEvent(ctx, db, hub, realtime.Event{
+			Type: "plan.updated", PlanID: planID, Version: version, ActorID: uid.String(),
+		})
+
+		w.Header().Set("ETag", planETag(version))
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(resp)
+	}
+}
@@ -22,12 +22,12 @@ func requireUserID(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		raw := r.Header.Get("X-User-Id")
 		if raw == "" {
-			http.Error(w, "missing X-User-Id", http.StatusUnauthorized)
+			httpError(w, "missing X-User-Id", http.StatusUnauthorized)
 			return
 		}
 		id, err := uuid.Parse(raw)
 		if err != nil {
-			http.Error(w, "invalid X-User-Id", http.StatusBadRequest)
+			httpError(w, "invalid X-User-Id", http.StatusBadRequest)
 			return
 		}
 
@@ -0,0 +1,69 @@
+package ratelimit
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Postgres is a Store shared by every instance on the same database
+// (public.rate_limit_buckets, migration 015).
+type Postgres struct {
+	db *pgxpool.Pool
+}
+
+func NewPostgres(db *pgxpool.Pool) *Postgres {
+	return &Postgres{db: db}
+}
+
+func (p *Postgres) Take(ctx context.Context, key string, l Limit) (bool, time.Duration, error) {
+	var ok bool
+	var tokens float64
+	err := p.db.QueryRow(ctx, `
+		select allowed, left_tokens from public.rate_limit_take($1, $2, $3)
+	`, key, float64(l.Burst), l.Rate).Scan(&ok, &tokens)
+	if err != nil {
+		return false, 0, err
+	}
+	if ok {
+		return true, 0, nil
+	}
+	return false, time.Duration((1 - tokens) / l.Rate * float64(time.Second)), nil
+}
+
+// Purge drops buckets idle for a day (they are full again by then) and
+// AI quota counts from before yesterday, both from migration 015.
+func Purge(ctx context.Context, db *pgxpool.Pool) error {
+	_, err := db.Exec(ctx, `
+		delete from public.rate_limit_buckets where updated_at < now() - interval '1 day'
+	`)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(ctx, `
+		delete from public.ai_quota_usage where day < (now() at time zone 'utc')::date - 1
+	`)
+	return err
+}
+
+// RunPurge calls Purge every interval until ctx is done.
+func RunPurge(ctx context.Context, db *pgxpool.Pool, every time.Duration) {
+	t := time.NewTicker(every)
+	defer t.Stop()
+	for {
+		pctx, cancel := context.WithTimeout(ctx, time.Minute)
+		err := Purge(pctx, db)
+		cancel()
+		if err != nil {
+			log.Printf("rate limit purge failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
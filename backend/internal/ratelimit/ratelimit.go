@@ -0,0 +1,95 @@
+// Package ratelimit implements token buckets, kept in memory or in
+// Postgres when several API instances must share them.
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// Limit is a token bucket: Burst requests at once, refilled at Rate per
+// second.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// PerMinute allows n requests a minute, all of them at once if need be.
+func PerMinute(n int) Limit { return Limit{Rate: float64(n) / 60, Burst: n} }
+
+// PerHour allows n requests an hour, all of them at once if need be.
+func PerHour(n int) Limit { return Limit{Rate: float64(n) / 3600, Burst: n} }
+
+// Off reports whether l lets everything through.
+func (l Limit) Off() bool { return l.Rate <= 0 || l.Burst <= 0 }
+
+// Store takes one token from the bucket named key. When the bucket is
+// empty it returns false and how long until a token is back.
+type Store interface {
+	Take(ctx context.Context, key string, l Limit) (ok bool, retryAfter time.Duration, err error)
+}
+
+// refill is the bucket math both stores share: tokens after elapsed,
+// whether one could be taken, and the wait for the next one if not.
+func refill(tokens float64, elapsed time.Duration, l Limit) (left float64, ok bool, retryAfter time.Duration) {
+	tokens = math.Min(float64(l.Burst), tokens+elapsed.Seconds()*l.Rate)
+	if tokens >= 1 {
+		return tokens - 1, true, 0
+	}
+	wait := time.Duration((1 - tokens) / l.Rate * float64(time.Second))
+	return tokens, false, wait
+}
+
+type bucket struct {
+	tokens float64
+	at     time.Time
+	full   time.Duration // idle time after which the bucket is full again
+}
+
+// sweepEvery is how often Memory drops buckets that have refilled; a
+// full bucket is the same as no bucket.
+const sweepEvery = time.Minute
+
+// Memory is a Store for a single instance.
+type Memory struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+func NewMemory() *Memory {
+	return &Memory{buckets: make(map[string]*bucket), now: time.Now}
+}
+
+func (m *Memory) Take(_ context.Context, key string, l Limit) (bool, time.Duration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	if now.Sub(m.lastSweep) >= sweepEvery {
+		m.sweep(now)
+	}
+
+	b, found := m.buckets[key]
+	if !found {
+		full := time.Duration(float64(l.Burst) / l.Rate * float64(time.Second))
+		b = &bucket{tokens: float64(l.Burst), at: now, full: full}
+		m.buckets[key] = b
+	}
+	left, ok, wait := refill(b.tokens, now.Sub(b.at), l)
+	b.tokens, b.at = left, now
+	return ok, wait, nil
+}
+
+// sweep drops buckets idle long enough to be full again.
+func (m *Memory) sweep(now time.Time) {
+	m.lastSweep = now
+	for k, b := range m.buckets {
+		if now.Sub(b.at) > b.full {
+			delete(m.buckets, k)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryTake(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	m := NewMemory()
+	m.now = func() time.Time { return now }
+	l := PerMinute(2)
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		if ok, _, _ := m.Take(ctx, "a", l); !ok {
+			t.Fatalf("take %d refused within burst", i)
+		}
+	}
+	ok, wait, _ := m.Take(ctx, "a", l)
+	if ok {
+		t.Fatal("third take allowed")
+	}
+	if wait != 30*time.Second {
+		t.Errorf("retry after %v, want 30s", wait)
+	}
+	if ok, _, _ := m.Take(ctx, "b", l); !ok {
+		t.Error("buckets are not per key")
+	}
+
+	now = now.Add(30 * time.Second)
+	if ok, _, _ := m.Take(ctx, "a", l); !ok {
+		t.Error("no token after refill")
+	}
+
+	// Idle buckets are swept once full again.
+	now = now.Add(2 * time.Minute)
+	m.Take(ctx, "c", l)
+	if _, found := m.buckets["a"]; found {
+		t.Error("idle bucket not swept")
+	}
+}
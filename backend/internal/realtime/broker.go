@@ -0,0 +1,178 @@
+package realtime
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Event is pushed to connected clients when a plan they can see changes.
+// It carries ids only; clients refetch the plan (or sync) to get content.
+type Event struct {
+	Type      string    `json:"type"` // plan.updated | plan.deleted | day.updated | completion.updated
+	PlanID    string    `json:"plan_id"`
+	DayNumber *int      `json:"day_number,omitempty"`
+	Version   int       `json:"version,omitempty"`
+	ActorID   string    `json:"actor_id,omitempty"`
+	At        time.Time `json:"at"`
+}
+
+// envelope is what travels over NOTIFY: the event plus its recipients.
+type envelope struct {
+	UserIDs []uuid.UUID `json:"user_ids"`
+	Event   Event       `json:"event"`
+}
+
+// Per-connection buffer. A client that falls this far behind loses events
+// (it will catch up on its next refetch) rather than blocking publishers.
+const subscriberBuffer = 32
+
+// Broker fans events out to the WebSocket connections of each user.
+// By default delivery is in-process only. After ListenPostgres is running,
+// Publish goes through Postgres NOTIFY so every API instance delivers to
+// its own connections. A nil *Broker is valid and drops everything.
+type Broker struct {
+	mu   sync.RWMutex
+	subs map[uuid.UUID]map[chan Event]struct{}
+
+	pgMu    sync.RWMutex
+	pg      *pgxpool.Pool
+	channel string
+}
+
+func NewBroker() *Broker {
+	return &Broker{subs: make(map[uuid.UUID]map[chan Event]struct{})}
+}
+
+// Subscribe registers a connection for uid. Call the returned func to
+// unsubscribe; the channel is closed afterwards.
+func (b *Broker) Subscribe(uid uuid.UUID) (<-chan Event, func()) {
+	ch := make(chan Event, subscriberBuffer)
+	b.mu.Lock()
+	if b.subs[uid] == nil {
+		b.subs[uid] = make(map[chan Event]struct{})
+	}
+	b.subs[uid][ch] = struct{}{}
+	b.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subs[uid], ch)
+			if len(b.subs[uid]) == 0 {
+				delete(b.subs, uid)
+			}
+			b.mu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+// Publish sends ev to every connection of userIDs. Call it after the
+// change has been committed.
+func (b *Broker) Publish(ctx context.Context, ev Event, userIDs []uuid.UUID) {
+	if b == nil || len(userIDs) == 0 {
+		return
+	}
+	if ev.At.IsZero() {
+		ev.At = time.Now().UTC()
+	}
+
+	b.pgMu.RLock()
+	pg, channel := b.pg, b.channel
+	b.pgMu.RUnlock()
+
+	if pg != nil {
+		payload, _ := json.Marshal(envelope{UserIDs: userIDs, Event: ev})
+		_, err := pg.Exec(ctx, `select pg_notify($1, $2)`, channel, string(payload))
+		if err == nil {
+			return // our own LISTEN delivers it locally
+		}
+		log.Printf("realtime notify failed, delivering locally: %v", err)
+	}
+	b.deliver(ev, userIDs)
+}
+
+func (b *Broker) deliver(ev Event, userIDs []uuid.UUID) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, uid := range userIDs {
+		for ch := range b.subs[uid] {
+			select {
+			case ch <- ev:
+			default:
+			}
+		}
+	}
+}
+
+// ListenPostgres switches Publish to Postgres NOTIFY on channel and
+// delivers notifications from every instance to local subscribers.
+// It blocks until ctx is done, reconnecting with backoff on errors.
+func (b *Broker) ListenPostgres(ctx context.Context, pool *pgxpool.Pool, channel string) {
+	backoff := time.Second
+	for ctx.Err() == nil {
+		err := b.listenOnce(ctx, pool, channel)
+		b.setPG(nil, "")
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("realtime listen stopped: %v (retry in %s)", err, backoff)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, 30*time.Second)
+	}
+}
+
+func (b *Broker) setPG(pool *pgxpool.Pool, channel string) {
+	b.pgMu.Lock()
+	b.pg, b.channel = pool, channel
+	b.pgMu.Unlock()
+}
+
+func (b *Broker) listenOnce(ctx context.Context, pool *pgxpool.Pool, channel string) error {
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Release()
+
+	if _, err := conn.Exec(ctx, "listen "+quoteIdent(channel)); err != nil {
+		return err
+	}
+	b.setPG(pool, channel)
+	log.Printf("realtime listening on postgres channel %q", channel)
+
+	for {
+		n, err := conn.Conn().WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		var env envelope
+		if err := json.Unmarshal([]byte(n.Payload), &env); err != nil {
+			log.Printf("realtime bad payload: %v", err)
+			continue
+		}
+		b.deliver(env.Event, env.UserIDs)
+	}
+}
+
+func quoteIdent(s string) string {
+	out := []byte{'"'}
+	for i := 0; i < len(s); i++ {
+		if s[i] == '"' {
+			out = append(out, '"')
+		}
+		out = append(out, s[i])
+	}
+	return string(append(out, '"'))
+}
@@ -0,0 +1,205 @@
+// Package splitcache remembers splitter output for goals that were asked
+// before: an in-memory LRU, optionally backed by Postgres so instances
+// share it and it survives restarts.
+package splitcache
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+
+	"sliceapp-backend/internal/ai"
+)
+
+// Key is everything the splitter's output depends on.
+type Key struct {
+	Goal          string
+	Days          int
+	DailyMinutes  int
+	PromptVersion string
+	Model         string
+}
+
+// NormalizeGoal folds the differences that don't change what the user
+// asked for: case, spacing and trailing punctuation.
+func NormalizeGoal(goal string) string {
+	goal = strings.Join(strings.Fields(strings.ToLower(goal)), " ")
+	return strings.TrimRightFunc(goal, unicode.IsPunct)
+}
+
+// Hash is the key as stored: the goal is normalized first.
+func (k Key) Hash() string {
+	raw := fmt.Sprintf("%s\x00%d\x00%d\x00%s\x00%s",
+		NormalizeGoal(k.Goal), k.Days, k.DailyMinutes, k.PromptVersion, k.Model)
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
+
+type entry struct {
+	key     string
+	value   []byte // JSON, so every Get hands out its own copy
+	expires time.Time
+}
+
+// Cache is safe for concurrent use. A nil *Cache never hits.
+type Cache struct {
+	ttl  time.Duration
+	size int
+	db   *pgxpool.Pool // nil = memory only
+
+	mu    sync.Mutex
+	order *list.List // front = most recently used
+	items map[string]*list.Element
+	now   func() time.Time
+}
+
+// New keeps up to size entries in memory for ttl. With db set, entries
+// are also written to public.splitter_cache (migration 017).
+func New(size int, ttl time.Duration, db *pgxpool.Pool) *Cache {
+	return &Cache{
+		ttl:   ttl,
+		size:  size,
+		db:    db,
+		order: list.New(),
+		items: make(map[string]*list.Element),
+		now:   time.Now,
+	}
+}
+
+// Get returns the cached output for k. Postgres errors count as a miss.
+func (c *Cache) Get(ctx context.Context, k Key) (*ai.SplitterResponse, bool) {
+	if c == nil {
+		return nil, false
+	}
+	hash := k.Hash()
+
+	raw, ok := c.getMemory(hash)
+	if !ok && c.db != nil {
+		var expires time.Time
+		err := c.db.QueryRow(ctx, `
+			select response, expires_at from public.splitter_cache
+			where key = $1 and expires_at > now()
+		`, hash).Scan(&raw, &expires)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			log.Printf("splitter cache get: %v", err)
+		}
+		if err == nil {
+			ok = true
+			c.putMemory(hash, raw, expires)
+		}
+	}
+	if !ok {
+		return nil, false
+	}
+
+	var out ai.SplitterResponse
+	if err := json.Unmarshal(raw, &out); err != nil {
+		log.Printf("splitter cache: bad entry %s: %v", hash, err)
+		return nil, false
+	}
+	return &out, true
+}
+
+// Put stores out under k.
+func (c *Cache) Put(ctx context.Context, k Key, out *ai.SplitterResponse) {
+	if c == nil || out == nil {
+		return
+	}
+	raw, err := json.Marshal(out)
+	if err != nil {
+		return
+	}
+	hash := k.Hash()
+	expires := c.now().Add(c.ttl)
+	c.putMemory(hash, raw, expires)
+
+	if c.db != nil {
+		_, err := c.db.Exec(ctx, `
+			insert into public.splitter_cache (key, response, expires_at)
+			values ($1, $2, $3)
+			on conflict (key) do update
+			  set response = excluded.response, expires_at = excluded.expires_at, created_at = now()
+		`, hash, raw, expires)
+		if err != nil {
+			log.Printf("splitter cache put: %v", err)
+		}
+	}
+}
+
+func (c *Cache) getMemory(hash string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[hash]
+	if !ok {
+		return nil, false
+	}
+	e := el.Value.(*entry)
+	if !c.now().Before(e.expires) {
+		c.order.Remove(el)
+		delete(c.items, hash)
+		return nil, false
+	}
+	c.order.MoveToFront(el)
+	return e.value, true
+}
+
+func (c *Cache) putMemory(hash string, raw []byte, expires time.Time) {
+	if c.size <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[hash]; ok {
+		e := el.Value.(*entry)
+		e.value, e.expires = raw, expires
+		c.order.MoveToFront(el)
+		return
+	}
+	c.items[hash] = c.order.PushFront(&entry{key: hash, value: raw, expires: expires})
+	for c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.items, oldest.Value.(*entry).key)
+	}
+}
+
+// Purge drops expired entries from public.splitter_cache. Memory entries
+// expire on their own.
+func Purge(ctx context.Context, db *pgxpool.Pool) error {
+	_, err := db.Exec(ctx, `delete from public.splitter_cache where expires_at <= now()`)
+	return err
+}
+
+// RunPurge calls Purge every interval until ctx is done.
+func RunPurge(ctx context.Context, db *pgxpool.Pool, every time.Duration) {
+	t := time.NewTicker(every)
+	defer t.Stop()
+	for {
+		pctx, cancel := context.WithTimeout(ctx, time.Minute)
+		err := Purge(pctx, db)
+		cancel()
+		if err != nil {
+			log.Printf("splitter cache purge failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
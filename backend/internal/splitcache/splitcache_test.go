@@ -0,0 +1,55 @@
+package splitcache
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"sliceapp-backend/internal/ai"
+)
+
+func TestCache(t *testing.T) {
+	ctx := context.Background()
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := New(2, time.Hour, nil)
+	c.now = func() time.Time { return now }
+
+	key := func(goal string) Key {
+		return Key{Goal: goal, Days: 7, DailyMinutes: 30, PromptVersion: "1", Model: "m"}
+	}
+	resp := func(title string) *ai.SplitterResponse {
+		return &ai.SplitterResponse{Plan: ai.SplitterPlan{Title: title}}
+	}
+
+	c.Put(ctx, key("Learn Python"), resp("python"))
+	got, ok := c.Get(ctx, key("  learn   python! "))
+	if !ok || got.Plan.Title != "python" {
+		t.Fatalf("normalized goal missed: %v %+v", ok, got)
+	}
+	other := key("learn python")
+	other.PromptVersion = "2"
+	if _, ok := c.Get(ctx, other); ok {
+		t.Error("hit across prompt versions")
+	}
+
+	// Least recently used goes first.
+	c.Put(ctx, key("run 5k"), resp("run"))
+	c.Get(ctx, key("learn python"))
+	c.Put(ctx, key("write a novel"), resp("novel"))
+	if _, ok := c.Get(ctx, key("run 5k")); ok {
+		t.Error("LRU entry not evicted")
+	}
+	if _, ok := c.Get(ctx, key("learn python")); !ok {
+		t.Error("recently used entry evicted")
+	}
+
+	now = now.Add(time.Hour)
+	if _, ok := c.Get(ctx, key("learn python")); ok {
+		t.Error("expired entry served")
+	}
+
+	var none *Cache
+	if _, ok := none.Get(ctx, key("x")); ok {
+		t.Error("nil cache hit")
+	}
+}
@@ -0,0 +1,9 @@
+-- Read-only public share links for a plan.
+-- One active link per plan; minting a new link replaces the old token.
+create table if not exists public.plan_shares (
+  plan_id    uuid primary key references public.plans (id) on delete cascade,
+  token      text not null unique,
+  hide_notes boolean not null default false,
+  expires_at timestamptz,
+  created_at timestamptz not null default now()
+);
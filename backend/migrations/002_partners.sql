@@ -0,0 +1,37 @@
+-- Accountability partners: invitations plus a feed of partner events.
+create table if not exists public.partner_invites (
+  id           uuid primary key default gen_random_uuid(),
+  inviter_id   uuid not null references public.users (id) on delete cascade,
+  invitee_id   uuid not null references public.users (id) on delete cascade,
+  status       text not null default 'pending'
+               check (status in ('pending', 'accepted', 'declined')),
+  created_at   timestamptz not null default now(),
+  responded_at timestamptz,
+  check (inviter_id <> invitee_id)
+);
+
+-- At most one open (pending or accepted) link per pair, in either direction.
+create unique index if not exists partner_invites_pair_open_idx
+  on public.partner_invites (least(inviter_id, invitee_id), greatest(inviter_id, invitee_id))
+  where status <> 'declined';
+
+create index if not exists partner_invites_invitee_idx
+  on public.partner_invites (invitee_id, status);
+
+-- One row per recipient; day_done events are fanned out to every partner.
+create table if not exists public.partner_events (
+  id         bigserial primary key,
+  actor_id   uuid not null references public.users (id) on delete cascade,
+  target_id  uuid not null references public.users (id) on delete cascade,
+  plan_id    uuid references public.plans (id) on delete cascade,
+  day_number int,
+  kind       text not null check (kind in ('nudge', 'cheer', 'day_done')),
+  message    text not null default '',
+  created_at timestamptz not null default now(),
+  seen_at    timestamptz
+);
+
+create index if not exists partner_events_target_idx
+  on public.partner_events (target_id, id desc);
+create index if not exists partner_events_actor_idx
+  on public.partner_events (actor_id, id desc);
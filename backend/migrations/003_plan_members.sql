@@ -0,0 +1,48 @@
+-- Shared team plans: members with roles, step claims and per-member completion.
+
+-- Day rows are addressed by (plan_id, day_number) from the tables below.
+create unique index if not exists plan_days_plan_day_idx
+  on public.plan_days (plan_id, day_number);
+
+create table if not exists public.plan_members (
+  plan_id    uuid not null references public.plans (id) on delete cascade,
+  user_id    uuid not null references public.users (id) on delete cascade,
+  role       text not null check (role in ('owner', 'editor', 'viewer')),
+  created_at timestamptz not null default now(),
+  primary key (plan_id, user_id)
+);
+
+create index if not exists plan_members_user_idx
+  on public.plan_members (user_id, plan_id);
+
+-- Every existing plan keeps its single owner.
+insert into public.plan_members (plan_id, user_id, role)
+select id, user_id, 'owner' from public.plans
+on conflict (plan_id, user_id) do nothing;
+
+-- One member per step; day renumbering cascades through the FK.
+create table if not exists public.plan_step_claims (
+  plan_id    uuid not null,
+  day_number int  not null,
+  step_index int  not null check (step_index >= 0),
+  user_id    uuid not null,
+  claimed_at timestamptz not null default now(),
+  primary key (plan_id, day_number, step_index),
+  foreign key (plan_id, day_number)
+    references public.plan_days (plan_id, day_number) on update cascade on delete cascade,
+  foreign key (plan_id, user_id)
+    references public.plan_members (plan_id, user_id) on delete cascade
+);
+
+create table if not exists public.plan_member_days (
+  plan_id    uuid not null,
+  day_number int  not null,
+  user_id    uuid not null,
+  is_done    boolean not null default false,
+  updated_at timestamptz not null default now(),
+  primary key (plan_id, day_number, user_id),
+  foreign key (plan_id, day_number)
+    references public.plan_days (plan_id, day_number) on update cascade on delete cascade,
+  foreign key (plan_id, user_id)
+    references public.plan_members (plan_id, user_id) on delete cascade
+);
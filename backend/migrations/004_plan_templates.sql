@@ -0,0 +1,18 @@
+-- Plan templates. goal_type is now kept on the plan so templates can
+-- default to it (it used to live only in the create response meta).
+alter table public.plans add column if not exists goal_type text;
+
+create table if not exists public.plan_templates (
+  id                    uuid primary key default gen_random_uuid(),
+  user_id               uuid not null references public.users (id) on delete cascade,
+  source_plan_id        uuid references public.plans (id) on delete set null,
+  title                 text not null,
+  goal_type             text not null,
+  days                  int  not null check (days > 0),
+  source_daily_minutes  int  not null check (source_daily_minutes > 0),
+  items                 jsonb not null,
+  created_at            timestamptz not null default now()
+);
+
+create index if not exists plan_templates_user_goal_idx
+  on public.plan_templates (user_id, goal_type, created_at desc);
@@ -0,0 +1,6 @@
+-- Duplicated plans keep a link back to the plan they were copied from.
+alter table public.plans
+  add column if not exists source_plan_id uuid references public.plans (id) on delete set null;
+
+create index if not exists plans_source_plan_idx
+  on public.plans (source_plan_id) where source_plan_id is not null;
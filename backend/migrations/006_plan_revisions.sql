@@ -0,0 +1,15 @@
+-- Revision log for plans and days. day_number null = whole-plan revision.
+-- before/after hold the JSON state of the day (or plan) around the change.
+create table if not exists public.plan_revisions (
+  id         bigserial primary key,
+  plan_id    uuid not null references public.plans (id) on delete cascade,
+  day_number int,
+  user_id    uuid references public.users (id) on delete set null,
+  action     text not null,
+  before     jsonb,
+  after      jsonb,
+  created_at timestamptz not null default now()
+);
+
+create index if not exists plan_revisions_plan_idx
+  on public.plan_revisions (plan_id, id desc);
@@ -0,0 +1,2 @@
+-- Optimistic concurrency: bumped on every change to a plan or its days.
+alter table public.plans add column if not exists version int not null default 1;
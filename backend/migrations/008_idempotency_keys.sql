@@ -0,0 +1,17 @@
+-- Stored responses for Idempotency-Key replays on mutating endpoints.
+-- status_code is null while the first request is still running.
+create table if not exists public.idempotency_keys (
+  user_id          uuid not null,
+  key              text not null,
+  method           text not null,
+  path             text not null,
+  request_hash     text not null,
+  status_code      int,
+  response_headers jsonb,
+  response_body    bytea,
+  created_at       timestamptz not null default now(),
+  primary key (user_id, key)
+);
+
+create index if not exists idempotency_keys_created_idx
+  on public.idempotency_keys (created_at);
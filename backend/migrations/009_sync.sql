@@ -0,0 +1,146 @@
+-- Offline sync: every plan/day/completion/membership row carries a global
+-- change_seq (the sync cursor), updated_at, and per-field write times used
+-- for last-writer-wins. Deletions leave tombstones.
+create sequence if not exists public.change_seq;
+
+alter table public.plans
+  add column if not exists updated_at  timestamptz not null default now(),
+  add column if not exists change_seq  bigint not null default nextval('public.change_seq'),
+  add column if not exists field_times jsonb not null default '{}';
+
+alter table public.plan_days
+  add column if not exists updated_at  timestamptz not null default now(),
+  add column if not exists change_seq  bigint not null default nextval('public.change_seq'),
+  add column if not exists field_times jsonb not null default '{}';
+
+alter table public.plan_member_days
+  add column if not exists change_seq  bigint not null default nextval('public.change_seq');
+
+alter table public.plan_members
+  add column if not exists change_seq  bigint not null default nextval('public.change_seq');
+
+create index if not exists plans_change_seq_idx on public.plans (change_seq);
+create index if not exists plan_days_change_seq_idx on public.plan_days (plan_id, change_seq);
+create index if not exists plan_member_days_change_seq_idx on public.plan_member_days (plan_id, change_seq);
+
+-- Stamps change_seq/updated_at on every write. TG_ARGV lists the columns
+-- whose write time is tracked in field_times; a column that changed gets
+-- now() unless the statement set its field_times entry itself (sync does,
+-- with the client's timestamp).
+create or replace function public.sync_stamp() returns trigger
+language plpgsql as $$
+declare
+  f    text;
+  newj jsonb;
+  oldj jsonb;
+begin
+  new.change_seq := nextval('public.change_seq');
+  new.updated_at := now();
+  if tg_nargs = 0 then
+    return new;
+  end if;
+
+  newj := to_jsonb(new);
+  if tg_op = 'INSERT' then
+    foreach f in array tg_argv loop
+      if not (new.field_times ? f) then
+        new.field_times := new.field_times || jsonb_build_object(f, now());
+      end if;
+    end loop;
+    return new;
+  end if;
+
+  oldj := to_jsonb(old);
+  foreach f in array tg_argv loop
+    if (newj -> f) is distinct from (oldj -> f)
+       and (new.field_times -> f) is not distinct from (old.field_times -> f) then
+      new.field_times := jsonb_set(new.field_times, array[f], to_jsonb(now()));
+    end if;
+  end loop;
+  return new;
+end $$;
+
+drop trigger if exists plans_sync_stamp on public.plans;
+create trigger plans_sync_stamp
+  before insert or update on public.plans
+  for each row execute function public.sync_stamp('title', 'days', 'daily_minutes');
+
+drop trigger if exists plan_days_sync_stamp on public.plan_days;
+create trigger plan_days_sync_stamp
+  before insert or update on public.plan_days
+  for each row execute function public.sync_stamp('focus', 'steps', 'is_done');
+
+create or replace function public.sync_stamp_seq() returns trigger
+language plpgsql as $$
+begin
+  new.change_seq := nextval('public.change_seq');
+  return new;
+end $$;
+
+drop trigger if exists plan_member_days_sync_stamp on public.plan_member_days;
+create trigger plan_member_days_sync_stamp
+  before insert or update on public.plan_member_days
+  for each row execute function public.sync_stamp_seq();
+
+drop trigger if exists plan_members_sync_stamp on public.plan_members;
+create trigger plan_members_sync_stamp
+  before insert or update on public.plan_members
+  for each row execute function public.sync_stamp_seq();
+
+-- Tombstones: user_ids are the members who must hear about the deletion.
+create table if not exists public.sync_tombstones (
+  change_seq bigint primary key default nextval('public.change_seq'),
+  kind       text not null check (kind in ('plan', 'day')),
+  plan_id    uuid not null,
+  day_number int,
+  user_ids   uuid[] not null,
+  deleted_at timestamptz not null default now()
+);
+
+create index if not exists sync_tombstones_users_idx
+  on public.sync_tombstones using gin (user_ids);
+
+create or replace function public.sync_tombstone_plan() returns trigger
+language plpgsql as $$
+begin
+  insert into public.sync_tombstones (kind, plan_id, user_ids)
+  select 'plan', old.id, coalesce(array_agg(m.user_id), array[old.user_id])
+  from public.plan_members m
+  where m.plan_id = old.id;
+  return old;
+end $$;
+
+drop trigger if exists plans_sync_tombstone on public.plans;
+create trigger plans_sync_tombstone
+  before delete on public.plans
+  for each row execute function public.sync_tombstone_plan();
+
+create or replace function public.sync_tombstone_day() returns trigger
+language plpgsql as $$
+begin
+  insert into public.sync_tombstones (kind, plan_id, day_number, user_ids)
+  select 'day', old.plan_id, old.day_number, array_agg(m.user_id)
+  from public.plan_members m
+  where m.plan_id = old.plan_id
+  having count(*) > 0;
+  return old;
+end $$;
+
+drop trigger if exists plan_days_sync_tombstone on public.plan_days;
+create trigger plan_days_sync_tombstone
+  before delete on public.plan_days
+  for each row execute function public.sync_tombstone_day();
+
+-- A member who leaves (or is removed) sees the plan as deleted.
+create or replace function public.sync_tombstone_member() returns trigger
+language plpgsql as $$
+begin
+  insert into public.sync_tombstones (kind, plan_id, user_ids)
+  values ('plan', old.plan_id, array[old.user_id]);
+  return old;
+end $$;
+
+drop trigger if exists plan_members_sync_tombstone on public.plan_members;
+create trigger plan_members_sync_tombstone
+  after delete on public.plan_members
+  for each row execute function public.sync_tombstone_member();
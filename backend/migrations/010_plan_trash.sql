@@ -0,0 +1,9 @@
+-- Soft delete: DELETE /plans/{id} sets deleted_at; the API's purge job
+-- hard-deletes rows older than TRASH_RETENTION_DAYS (which fires the sync
+-- tombstone trigger as before).
+alter table public.plans
+  add column if not exists deleted_at timestamptz;
+
+create index if not exists plans_deleted_at_idx
+  on public.plans (deleted_at)
+  where deleted_at is not null;
@@ -0,0 +1,18 @@
+-- Plan lifecycle. paused_at is set while the plan is paused or archived;
+-- paused_seconds accumulates finished pauses so the day clock can skip
+-- them.
+alter table public.plans
+  add column if not exists status text not null default 'active'
+    check (status in ('active', 'paused', 'archived', 'completed')),
+  add column if not exists paused_at      timestamptz,
+  add column if not exists paused_seconds bigint not null default 0,
+  add column if not exists completed_at   timestamptz;
+
+-- Plans whose days are already all done start out completed.
+update public.plans p
+set status = 'completed', completed_at = now()
+where p.status = 'active'
+  and exists (select 1 from public.plan_days d where d.plan_id = p.id)
+  and not exists (select 1 from public.plan_days d where d.plan_id = p.id and not d.is_done);
+
+create index if not exists plans_status_idx on public.plans (status);
@@ -0,0 +1,79 @@
+-- Full-text search for GET /plans?q=. One tsvector per plan covering the
+-- title (weight A) and every day's focus and step text (weight B), kept
+-- current by statement-level triggers. 'simple' config: plans are not all
+-- English.
+create table if not exists public.plan_search (
+  plan_id uuid primary key references public.plans(id) on delete cascade,
+  tsv     tsvector not null
+);
+
+create index if not exists plan_search_tsv_idx on public.plan_search using gin (tsv);
+
+create or replace function public.plan_search_refresh(pids uuid[]) returns void
+language sql as $$
+  insert into public.plan_search (plan_id, tsv)
+  select p.id,
+         setweight(to_tsvector('simple', coalesce(p.title, '')), 'A') ||
+         setweight(to_tsvector('simple', coalesce((
+           select string_agg(
+                    coalesce(d.focus, '') || ' ' || coalesce((
+                      select string_agg(
+                               concat_ws(' ', s->>'title', s->>'deliverable', s->>'done_definition'), ' ')
+                      from jsonb_array_elements(
+                             case when jsonb_typeof(d.steps) = 'array' then d.steps else '[]'::jsonb end) s
+                    ), ''), ' ')
+           from public.plan_days d
+           where d.plan_id = p.id
+         ), '')), 'B')
+  from public.plans p
+  where p.id = any(pids)
+  on conflict (plan_id) do update set tsv = excluded.tsv;
+$$;
+
+create or replace function public.plan_search_plans_trg() returns trigger
+language plpgsql as $$
+begin
+  perform public.plan_search_refresh(array(select distinct id from new_rows));
+  return null;
+end $$;
+
+create or replace function public.plan_search_days_trg() returns trigger
+language plpgsql as $$
+begin
+  perform public.plan_search_refresh(array(select distinct plan_id from changed_rows));
+  return null;
+end $$;
+
+drop trigger if exists plan_search_plans_ins on public.plans;
+create trigger plan_search_plans_ins
+  after insert on public.plans
+  referencing new table as new_rows
+  for each statement execute function public.plan_search_plans_trg();
+
+drop trigger if exists plan_search_plans_upd on public.plans;
+create trigger plan_search_plans_upd
+  after update on public.plans
+  referencing new table as new_rows
+  for each statement execute function public.plan_search_plans_trg();
+
+drop trigger if exists plan_search_days_ins on public.plan_days;
+create trigger plan_search_days_ins
+  after insert on public.plan_days
+  referencing new table as changed_rows
+  for each statement execute function public.plan_search_days_trg();
+
+drop trigger if exists plan_search_days_upd on public.plan_days;
+create trigger plan_search_days_upd
+  after update on public.plan_days
+  referencing new table as changed_rows
+  for each statement execute function public.plan_search_days_trg();
+
+drop trigger if exists plan_search_days_del on public.plan_days;
+create trigger plan_search_days_del
+  after delete on public.plan_days
+  referencing old table as changed_rows
+  for each statement execute function public.plan_search_days_trg();
+
+select public.plan_search_refresh(array(select id from public.plans));
+
+create index if not exists plans_created_at_id_idx on public.plans (created_at desc, id desc);
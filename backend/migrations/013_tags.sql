@@ -0,0 +1,21 @@
+-- User-defined plan tags. Tags are personal: each member labels a shared
+-- plan with their own tags, and nobody else sees them.
+create table if not exists public.tags (
+  id         uuid primary key default gen_random_uuid(),
+  user_id    uuid not null references public.users (id) on delete cascade,
+  name       text not null check (length(name) between 1 and 40),
+  color      text not null default '#888888' check (color ~ '^#[0-9a-fA-F]{6}$'),
+  created_at timestamptz not null default now()
+);
+
+create unique index if not exists tags_user_name_idx
+  on public.tags (user_id, lower(name));
+
+create table if not exists public.plan_tags (
+  tag_id     uuid not null references public.tags (id) on delete cascade,
+  plan_id    uuid not null references public.plans (id) on delete cascade,
+  created_at timestamptz not null default now(),
+  primary key (tag_id, plan_id)
+);
+
+create index if not exists plan_tags_plan_idx on public.plan_tags (plan_id, tag_id);
@@ -0,0 +1,45 @@
+-- Day status: pending | done | bad_day | skipped.
+--   done     all of the day's work
+--   bad_day  only the BAD DAY step; counts as done for streaks and completion
+--   skipped  postponed: the day moves to the next calendar day and pushes
+--            every later day with it (skip_count records how often)
+-- is_done stays as the "counts as done" flag; the trigger keeps the two in
+-- step so writers that only know is_done keep working.
+alter table public.plan_days
+  add column if not exists status text not null default 'pending'
+    check (status in ('pending', 'done', 'bad_day', 'skipped')),
+  add column if not exists skip_count int not null default 0;
+
+update public.plan_days set status = 'done' where is_done and status = 'pending';
+
+create or replace function public.plan_day_status() returns trigger
+language plpgsql as $$
+begin
+  if tg_op = 'INSERT' then
+    if new.status = 'pending' and new.is_done then
+      new.status := 'done';
+    end if;
+  elsif new.status is distinct from old.status then
+    null;
+  elsif new.is_done is distinct from old.is_done then
+    new.status := case when new.is_done then 'done' else 'pending' end;
+  end if;
+
+  new.is_done := new.status in ('done', 'bad_day');
+  if new.status = 'skipped' and (tg_op = 'INSERT' or old.status <> 'skipped') then
+    new.skip_count := new.skip_count + 1;
+  end if;
+  return new;
+end $$;
+
+-- Named to sort before plan_days_sync_stamp so field_times sees the final
+-- is_done/status.
+drop trigger if exists plan_days_day_status on public.plan_days;
+create trigger plan_days_day_status
+  before insert or update on public.plan_days
+  for each row execute function public.plan_day_status();
+
+drop trigger if exists plan_days_sync_stamp on public.plan_days;
+create trigger plan_days_sync_stamp
+  before insert or update on public.plan_days
+  for each row execute function public.sync_stamp('focus', 'steps', 'is_done', 'status');
@@ -0,0 +1,40 @@
+-- Token buckets for rate limiting when RATE_LIMIT_PG=true, shared by every
+-- API instance. A missing row is a full bucket; idle rows are purged by
+-- ratelimit.RunPurge.
+create table if not exists public.rate_limit_buckets (
+  key        text primary key,
+  tokens     double precision not null,
+  updated_at timestamptz not null default now()
+);
+
+-- rate_limit_take refills the bucket for the time since its last use, then
+-- takes one token if there is one. The upsert locks the row, so concurrent
+-- callers can't both spend the last token.
+create or replace function public.rate_limit_take(
+  p_key text, p_burst double precision, p_rate double precision,
+  out allowed boolean, out left_tokens double precision
+)
+language plpgsql as $$
+begin
+  insert into public.rate_limit_buckets as b (key, tokens, updated_at)
+  values (p_key, p_burst, now())
+  on conflict (key) do update
+    set tokens = least(p_burst, b.tokens + extract(epoch from now() - b.updated_at) * p_rate),
+        updated_at = now()
+  returning b.tokens into left_tokens;
+
+  allowed := left_tokens >= 1;
+  if allowed then
+    left_tokens := left_tokens - 1;
+    update public.rate_limit_buckets set tokens = left_tokens where key = p_key;
+  end if;
+end $$;
+
+-- Real AI generations per user per UTC day, for AI_DAILY_QUOTA. No foreign
+-- key: the quota is taken before the user row is first written.
+create table if not exists public.ai_quota_usage (
+  user_id uuid not null,
+  day     date not null,
+  used    int not null default 0 check (used >= 0),
+  primary key (user_id, day)
+);
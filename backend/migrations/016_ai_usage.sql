@@ -0,0 +1,19 @@
+-- One row per request that called the AI: who, for which plan, with which
+-- model, the tokens it used and what that cost at AI_PRICES. plan_id is
+-- null when the call didn't end up in a plan (e.g. it failed).
+create table if not exists public.ai_usage (
+  id            bigserial primary key,
+  user_id       uuid not null,
+  plan_id       uuid references public.plans (id) on delete set null,
+  operation     text not null check (operation in ('create_plan', 'generate_day', 'shrink_days')),
+  model         text not null,
+  input_tokens  int not null default 0,
+  cached_tokens int not null default 0,
+  output_tokens int not null default 0,
+  cost_usd      numeric(12, 6) not null default 0,
+  created_at    timestamptz not null default now()
+);
+
+create index if not exists ai_usage_created_idx on public.ai_usage (created_at);
+create index if not exists ai_usage_user_idx on public.ai_usage (user_id, created_at);
+create index if not exists ai_usage_plan_idx on public.ai_usage (plan_id) where plan_id is not null;
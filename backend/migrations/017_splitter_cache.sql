@@ -0,0 +1,11 @@
+-- Splitter output by request (SPLITTER_CACHE_PG=true). key hashes the
+-- normalized goal, days, daily_minutes, prompt version and model; expired
+-- rows are purged by splitcache.RunPurge.
+create table if not exists public.splitter_cache (
+  key        text primary key,
+  response   jsonb not null,
+  created_at timestamptz not null default now(),
+  expires_at timestamptz not null
+);
+
+create index if not exists splitter_cache_expires_idx on public.splitter_cache (expires_at);
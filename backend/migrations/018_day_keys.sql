@@ -0,0 +1,30 @@
+-- Stable day identity. Inserting, removing and moving days renumber
+-- plan_days, so day_number can't tell which day a revision was about.
+-- day_key stays with a day through renumbering; day revisions record it so
+-- a day-scoped revert only replays that day's own history, wherever it is
+-- now. day_number on a revision stays the number at the time, which is
+-- what a whole-plan revert replays against.
+alter table public.plan_days
+  add column if not exists day_key uuid not null default gen_random_uuid();
+
+create index if not exists plan_days_day_key_idx
+  on public.plan_days (plan_id, day_key);
+
+alter table public.plan_revisions
+  add column if not exists day_key uuid;
+
+create index if not exists plan_revisions_day_key_idx
+  on public.plan_revisions (plan_id, day_key, id desc)
+  where day_key is not null;
+
+-- Existing day revisions can only be matched by number, which is safe
+-- while nothing whole-plan (a renumber among them) came after them.
+update public.plan_revisions r
+set day_key = d.day_key
+from public.plan_days d
+where d.plan_id = r.plan_id and d.day_number = r.day_number
+  and r.day_key is null
+  and not exists (
+    select 1 from public.plan_revisions s
+    where s.plan_id = r.plan_id and s.day_number is null and s.id > r.id
+  );
@@ -0,0 +1,67 @@
+-- Sync cursor by transaction id. Every synced row (and tombstone) now also
+-- carries change_xid, the id of the transaction that last wrote it, and
+-- that is what the cursor compares; change_seq only orders changes within
+-- a pull.
+--
+-- The cursor can't be a sequence value: nextval runs when the row is
+-- written, not when it commits, so a transaction holding seq N can become
+-- visible after one holding N+1 has already been pulled past. Transaction
+-- ids fix that: a pull hands out the xmin of its snapshot, and every
+-- transaction below it had committed (and was seen) by then.
+alter table public.plans
+  add column if not exists change_xid xid8 not null default pg_current_xact_id();
+alter table public.plan_days
+  add column if not exists change_xid xid8 not null default pg_current_xact_id();
+alter table public.plan_member_days
+  add column if not exists change_xid xid8 not null default pg_current_xact_id();
+alter table public.plan_members
+  add column if not exists change_xid xid8 not null default pg_current_xact_id();
+alter table public.sync_tombstones
+  add column if not exists change_xid xid8 not null default pg_current_xact_id();
+
+create index if not exists plans_change_xid_idx on public.plans (change_xid);
+create index if not exists plan_days_change_xid_idx on public.plan_days (plan_id, change_xid);
+create index if not exists plan_member_days_change_xid_idx on public.plan_member_days (plan_id, change_xid);
+
+-- Same as in 009, plus change_xid. The triggers keep pointing at these.
+create or replace function public.sync_stamp() returns trigger
+language plpgsql as $$
+declare
+  f    text;
+  newj jsonb;
+  oldj jsonb;
+begin
+  new.change_seq := nextval('public.change_seq');
+  new.change_xid := pg_current_xact_id();
+  new.updated_at := now();
+  if tg_nargs = 0 then
+    return new;
+  end if;
+
+  newj := to_jsonb(new);
+  if tg_op = 'INSERT' then
+    foreach f in array tg_argv loop
+      if not (new.field_times ? f) then
+        new.field_times := new.field_times || jsonb_build_object(f, now());
+      end if;
+    end loop;
+    return new;
+  end if;
+
+  oldj := to_jsonb(old);
+  foreach f in array tg_argv loop
+    if (newj -> f) is distinct from (oldj -> f)
+       and (new.field_times -> f) is not distinct from (old.field_times -> f) then
+      new.field_times := jsonb_set(new.field_times, array[f], to_jsonb(now()));
+    end if;
+  end loop;
+  return new;
+end $$;
+
+create or replace function public.sync_stamp_seq() returns trigger
+language plpgsql as $$
+begin
+  new.change_seq := nextval('public.change_seq');
+  new.change_xid := pg_current_xact_id();
+  return new;
+end $$;
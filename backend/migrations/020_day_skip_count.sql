@@ -0,0 +1,28 @@
+-- A write that sets skip_count itself (a revert putting a snapshot back)
+-- keeps its value; only a fresh skip bumps the count. Otherwise the 014
+-- trigger would add one on top of every restored count.
+create or replace function public.plan_day_status() returns trigger
+language plpgsql as $$
+begin
+  if tg_op = 'INSERT' then
+    if new.status = 'pending' and new.is_done then
+      new.status := 'done';
+    end if;
+  elsif new.status is distinct from old.status then
+    null;
+  elsif new.is_done is distinct from old.is_done then
+    new.status := case when new.is_done then 'done' else 'pending' end;
+  end if;
+
+  new.is_done := new.status in ('done', 'bad_day');
+  if new.status = 'skipped' then
+    if tg_op = 'INSERT' then
+      if new.skip_count = 0 then
+        new.skip_count := 1;
+      end if;
+    elsif old.status <> 'skipped' and new.skip_count = old.skip_count then
+      new.skip_count := new.skip_count + 1;
+    end if;
+  end if;
+  return new;
+end $$;
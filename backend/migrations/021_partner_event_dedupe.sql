@@ -0,0 +1,12 @@
+-- A day produces one day_done event per partner, however often it is
+-- written as done (re-sent PATCHes, sync replays, batches).
+delete from public.partner_events e
+using public.partner_events d
+where e.kind = 'day_done' and d.kind = 'day_done'
+  and e.actor_id = d.actor_id and e.target_id = d.target_id
+  and e.plan_id = d.plan_id and e.day_number = d.day_number
+  and e.id > d.id;
+
+create unique index if not exists partner_events_day_done_idx
+  on public.partner_events (actor_id, target_id, plan_id, day_number)
+  where kind = 'day_done';
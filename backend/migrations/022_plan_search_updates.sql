@@ -0,0 +1,50 @@
+-- Updates only re-index plans whose text changed: plans and days are
+-- written on every tick, status change and version bump, and the 012
+-- update triggers re-indexed the whole plan each time.
+create or replace function public.plan_search_plans_upd_trg() returns trigger
+language plpgsql as $$
+declare
+  pids uuid[];
+begin
+  select array_agg(n.id) into pids
+  from new_rows n
+  join old_rows o on o.id = n.id
+  where n.title is distinct from o.title;
+  if pids is not null then
+    perform public.plan_search_refresh(pids);
+  end if;
+  return null;
+end $$;
+
+-- A renumbered day has no old row at its new number, so renumbering
+-- re-indexes too; that is rare next to ticks and status changes.
+create or replace function public.plan_search_days_upd_trg() returns trigger
+language plpgsql as $$
+declare
+  pids uuid[];
+begin
+  select array_agg(distinct n.plan_id) into pids
+  from new_rows n
+  where not exists (
+    select 1 from old_rows o
+    where o.plan_id = n.plan_id and o.day_number = n.day_number
+      and o.focus is not distinct from n.focus
+      and o.steps is not distinct from n.steps
+  );
+  if pids is not null then
+    perform public.plan_search_refresh(pids);
+  end if;
+  return null;
+end $$;
+
+drop trigger if exists plan_search_plans_upd on public.plans;
+create trigger plan_search_plans_upd
+  after update on public.plans
+  referencing old table as old_rows new table as new_rows
+  for each statement execute function public.plan_search_plans_upd_trg();
+
+drop trigger if exists plan_search_days_upd on public.plan_days;
+create trigger plan_search_days_upd
+  after update on public.plan_days
+  referencing old table as old_rows new table as new_rows
+  for each statement execute function public.plan_search_days_upd_trg();